@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// Access of one recipient to one secret, as far as the header and sidecar
+// tell. X25519 and plugin stanzas don't name their key, so without a
+// sidecar they leave the answer unknown.
+const (
+	accessYes     = "yes"
+	accessNo      = "no"
+	accessUnknown = "unknown"
+)
+
+var accessMatrixCmd = &cobra.Command{
+	Use:   "access-matrix",
+	Short: "Show which recipients can decrypt which secrets",
+	Long: `Print a table with a row per secret and a column per recipient, marking
+whether the recipient can decrypt the secret (✓), cannot (✗) or may (?).
+The columns are the current recipients, followed by any former ones that
+.recipients sidecars still record. Nothing is decrypted: SSH recipients are
+matched by the key tag in the header, and X25519 and plugin recipients only
+through a sidecar from --record-recipients, without which they show as ?.`,
+	Args: usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asCSV, _ := cmd.Flags().GetBool("csv")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		if asCSV && asJSON {
+			return fmt.Errorf("%w: --csv and --json cannot be combined", ErrUsage)
+		}
+		recipients, err := effectiveRecipients()
+		if err != nil {
+			return fmt.Errorf("reading recipients: %w", err)
+		}
+
+		type row struct {
+			name     string
+			stanzas  []stanza
+			recorded []recipient
+		}
+		headers := loadHeaderCache()
+		columns := recipients
+		known := map[string]bool{}
+		for _, r := range recipients {
+			known[recipientID(r.Key)] = true
+		}
+		var rows []row
+		var failed []string
+		for _, name := range getSecretNames() {
+			path := filepath.Join(secretsDir, filepath.FromSlash(name))
+			stanzas, err := headers.readHeader(path)
+			if err != nil {
+				printWarning("✗ %s: %v\n", displayName(name), err)
+				failed = append(failed, name)
+				continue
+			}
+			recorded, _ := loadSidecar(path, stanzas)
+			for _, r := range recorded {
+				if !known[recipientID(r.Key)] {
+					known[recipientID(r.Key)] = true
+					columns = append(columns, r)
+				}
+			}
+			rows = append(rows, row{name, stanzas, recorded})
+		}
+		headers.save()
+
+		// Tables shorten bare keys; CSV and JSON keep them whole
+		names := make([]string, len(columns))
+		for i, c := range columns {
+			names[i] = recipientName(c)
+			if (asCSV || asJSON) && c.Comment == "" {
+				names[i] = c.Key
+			}
+		}
+		matrix := make([][]string, len(rows))
+		for i, r := range rows {
+			matrix[i] = make([]string, len(columns))
+			for j, c := range columns {
+				matrix[i][j] = secretAccess(c, r.stanzas, r.recorded)
+			}
+		}
+
+		switch {
+		case asJSON:
+			type secretAccessJSON struct {
+				Name   string            `json:"name"`
+				Access map[string]string `json:"access"`
+			}
+			out := struct {
+				Recipients []string           `json:"recipients"`
+				Secrets    []secretAccessJSON `json:"secrets"`
+			}{Recipients: names, Secrets: []secretAccessJSON{}}
+			for i, r := range rows {
+				access := map[string]string{}
+				for j, name := range names {
+					access[name] = matrix[i][j]
+				}
+				out.Secrets = append(out.Secrets, secretAccessJSON{displayName(r.name), access})
+			}
+			s, err := encodeJSON(out)
+			if err != nil {
+				return err
+			}
+			fmt.Println(s)
+		case asCSV:
+			w := csv.NewWriter(os.Stdout)
+			w.Write(append([]string{"secret"}, names...))
+			for i, r := range rows {
+				w.Write(append([]string{displayName(r.name)}, matrix[i]...))
+			}
+			w.Flush()
+			if err := w.Error(); err != nil {
+				return err
+			}
+		default:
+			marks := map[string]string{accessYes: "✓", accessNo: "✗", accessUnknown: "?"}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "SECRET\t"+strings.Join(names, "\t"))
+			for i, r := range rows {
+				cells := make([]string, len(columns))
+				for j, a := range matrix[i] {
+					cells[j] = marks[a]
+				}
+				fmt.Fprintln(w, displayName(r.name)+"\t"+strings.Join(cells, "\t"))
+			}
+			w.Flush()
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%d secrets could not be read: %s", len(failed), strings.Join(displayNames(failed), ", "))
+		}
+		return nil
+	},
+}
+
+// secretAccess tells whether recipient r can decrypt a secret with the
+// given header stanzas and recorded recipients, if any.
+func secretAccess(r recipient, stanzas []stanza, recorded []recipient) string {
+	if recorded != nil {
+		for _, rec := range recorded {
+			if recipientID(rec.Key) == recipientID(r.Key) {
+				return accessYes
+			}
+		}
+		return accessNo
+	}
+	if tag := sshTag(r.Key); tag != "" {
+		for _, s := range stanzas {
+			if (s.Type == "ssh-ed25519" || s.Type == "ssh-rsa") && len(s.Args) > 0 && s.Args[0] == tag {
+				return accessYes
+			}
+		}
+		return accessNo
+	}
+	// Any stanza that isn't SSH or a passphrase could be this key's
+	for _, s := range stanzas {
+		if s.Type != "scrypt" && s.Type != "ssh-ed25519" && s.Type != "ssh-rsa" {
+			return accessUnknown
+		}
+	}
+	return accessNo
+}
+
+func init() {
+	accessMatrixCmd.Flags().Bool("csv", false, "print the matrix as CSV, with yes, no or unknown cells")
+	accessMatrixCmd.Flags().Bool("json", false, "print the matrix as JSON, with yes, no or unknown per recipient")
+	accessMatrixCmd.Flags().BoolVar(&noCacheFlag, "no-cache", false, "parse every header again instead of using the header cache")
+}
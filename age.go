@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ageInfo describes the age binary found on PATH.
+type ageInfo struct {
+	Path    string
+	Version string // as printed by age --version, e.g. "v1.2.1"
+	parts   []int  // parsed major, minor, patch; nil for dev builds
+}
+
+// ageBinaryFlag is set by --age-binary and takes precedence over AGE_BINARY.
+var ageBinaryFlag string
+
+var (
+	agePathOnce sync.Once
+	agePathVal  string
+	agePathErr  error
+
+	ageOnce     sync.Once
+	ageDetected ageInfo
+	ageErr      error
+)
+
+// agePath resolves the age executable from --age-binary, AGE_BINARY or PATH.
+func agePath() (string, error) {
+	agePathOnce.Do(func() {
+		name := "age"
+		if env := os.Getenv("AGE_BINARY"); env != "" {
+			name = env
+		}
+		if ageBinaryFlag != "" {
+			name = ageBinaryFlag
+		}
+		agePathVal, agePathErr = exec.LookPath(name)
+		if agePathErr != nil {
+			agePathErr = fmt.Errorf("%w: %v", ErrAgeNotFound, agePathErr)
+		}
+	})
+	return agePathVal, agePathErr
+}
+
+// retries is set by --retries: how many times to re-run an external
+// command that failed to start or lost its I/O.
+var retries = 2
+
+// withRetry runs fn, retrying transient failures with a short exponential
+// backoff. A process that ran and exited non-zero (a wrong key, say) is a
+// real answer and is never retried.
+func withRetry(what string, fn func() error) error {
+	delay := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= retries || !isTransient(err) {
+			return err
+		}
+		printVerbose("Retrying %s after error: %v\n", what, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isTransient reports whether err might go away on another try. A missing
+// executable won't.
+func isTransient(err error) bool {
+	var exitErr *exec.ExitError
+	return !errors.As(err, &exitErr) && !errors.Is(err, ErrAgeNotFound) &&
+		!errors.Is(err, exec.ErrNotFound) && !errors.Is(err, os.ErrNotExist)
+}
+
+// ageCommand builds an exec.Cmd for the resolved age binary.
+func ageCommand(args ...string) (*exec.Cmd, error) {
+	path, err := agePath()
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(path, args...), nil
+}
+
+// detectAge locates the age binary and parses its version. The result is
+// cached for the lifetime of the process.
+func detectAge() (ageInfo, error) {
+	ageOnce.Do(func() {
+		path, err := agePath()
+		if err != nil {
+			ageErr = err
+			return
+		}
+		out, err := exec.Command(path, "--version").Output()
+		if err != nil {
+			ageErr = fmt.Errorf("running age --version: %w", err)
+			return
+		}
+		version := strings.TrimSpace(string(out))
+		ageDetected = ageInfo{Path: path, Version: version, parts: parseVersion(version)}
+		printVerbose("Using age %s (%s)\n", version, path)
+	})
+	return ageDetected, ageErr
+}
+
+// parseVersion parses "v1.2.3" or "1.2.3". It returns nil for anything else,
+// such as "(devel)".
+func parseVersion(v string) []int {
+	fields := strings.Fields(v)
+	if len(fields) == 0 {
+		return nil
+	}
+	v = strings.TrimPrefix(fields[0], "v")
+	// Drop pre-release and build suffixes like -rc.1 or +dirty
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	nums := strings.Split(v, ".")
+	if len(nums) != 3 {
+		return nil
+	}
+	parts := make([]int, 3)
+	for i, f := range nums {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return nil
+		}
+		parts[i] = n
+	}
+	return parts
+}
+
+// atLeast reports whether the detected version is min or newer. Versions
+// that could not be parsed are assumed to be recent enough.
+func (a ageInfo) atLeast(min string) bool {
+	want := parseVersion(min)
+	if a.parts == nil || want == nil {
+		return true
+	}
+	for i := range want {
+		if a.parts[i] != want[i] {
+			return a.parts[i] > want[i]
+		}
+	}
+	return true
+}
+
+// requireAge returns an error naming feature if the age binary is older
+// than min.
+func requireAge(min, feature string) error {
+	info, err := detectAge()
+	if err != nil {
+		return err
+	}
+	if !info.atLeast(min) {
+		return fmt.Errorf("%s requires age >= %s, found %s", feature, min, info.Version)
+	}
+	return nil
+}
+
+// isPluginRecipient reports whether key is an age plugin recipient such as
+// age1yubikey1.... The bech32 data charset has no "1", so any after the
+// "age1" prefix marks a plugin name.
+func isPluginRecipient(key string) bool {
+	return strings.HasPrefix(key, "age1") && strings.Contains(key[len("age1"):], "1")
+}
+
+// pluginMinVersion is the first age release that supports plugins.
+const pluginMinVersion = "1.0.0"
+
+// checkRecipientFeatures fails early with a clear message when the
+// recipients need a newer age than the one installed.
+func checkRecipientFeatures(recipients []recipient) error {
+	for _, r := range recipients {
+		if isPluginRecipient(r.Key) {
+			return requireAge(pluginMinVersion, "plugin recipient on line "+strconv.Itoa(r.Line))
+		}
+	}
+	return nil
+}
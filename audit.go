@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// auditRecord is one line of the audit log, which is JSON lines.
+type auditRecord struct {
+	Time   time.Time `json:"time"`
+	Op     string    `json:"op"`
+	Secret string    `json:"secret"`
+	User   string    `json:"user"`
+}
+
+// recordAudit appends a record per secret to the audit_log file, if one is
+// configured. A failure to log only warns, as the operation has already
+// happened.
+func recordAudit(op string, names ...string) {
+	if cfg.AuditLog == "" {
+		return
+	}
+	path := expandHome(cfg.AuditLog)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		printWarning("Warning: writing audit log: %v\n", err)
+		return
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		printWarning("Warning: writing audit log: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	who := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		who = u.Username
+	}
+	now := time.Now().UTC()
+	enc := json.NewEncoder(f)
+	for _, name := range names {
+		if err := enc.Encode(auditRecord{Time: now, Op: op, Secret: name, User: who}); err != nil {
+			printWarning("Warning: writing audit log: %v\n", err)
+			return
+		}
+	}
+}
+
+// auditFilter selects records for the audit command.
+type auditFilter struct {
+	secret string
+	since  time.Time
+}
+
+func (f auditFilter) match(r auditRecord) bool {
+	if f.secret != "" && r.Secret != f.secret {
+		return false
+	}
+	return f.since.IsZero() || !r.Time.Before(f.since)
+}
+
+func printAuditRecord(r auditRecord, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(os.Stdout).Encode(r)
+	}
+	_, err := fmt.Printf("%s  %-18s %-30s %s\n", r.Time.Local().Format(time.RFC3339), r.Op, displayName(r.Secret), r.User)
+	return err
+}
+
+// readAudit prints the matching records from r up to its end. A final
+// line without a newline is still being written; it is returned, to be
+// completed by the next call. Lines that don't parse are reported and
+// skipped rather than ending the listing.
+func readAudit(r *bufio.Reader, partial []byte, filter auditFilter, asJSON bool) ([]byte, error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		partial = append(partial, line...)
+		if err == io.EOF {
+			return partial, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rec auditRecord
+		if err := json.Unmarshal(partial, &rec); err != nil {
+			printWarning("✗ skipping malformed audit line: %v\n", err)
+		} else if filter.match(rec) {
+			if err := printAuditRecord(rec, asJSON); err != nil {
+				return nil, err
+			}
+		}
+		partial = nil
+	}
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit log",
+	Long: `Show the audit log written to the audit_log file set in the config, which
+records every get, copy, reveal and change of a secret. --follow keeps
+printing new entries as they are logged.`,
+	Args: usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		secret, _ := cmd.Flags().GetString("secret")
+		since, _ := cmd.Flags().GetString("since")
+		follow, _ := cmd.Flags().GetBool("follow")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		if cfg.AuditLog == "" {
+			return fmt.Errorf("%w: set audit_log in the config to enable the audit log", ErrUsage)
+		}
+
+		var filter auditFilter
+		if secret != "" {
+			name, _, err := resolveSecret(secret)
+			if err != nil {
+				return err
+			}
+			filter.secret = name
+		}
+		if since != "" {
+			d, err := parseDuration(since)
+			if err != nil {
+				return fmt.Errorf("%w: --since: %v", ErrUsage, err)
+			}
+			filter.since = time.Now().Add(-d)
+		}
+
+		f, err := os.Open(expandHome(cfg.AuditLog))
+		if os.IsNotExist(err) && !follow {
+			return nil
+		}
+		// On a fresh store the log appears with the first logged access
+		for os.IsNotExist(err) {
+			time.Sleep(500 * time.Millisecond)
+			f, err = os.Open(expandHome(cfg.AuditLog))
+		}
+		if err != nil {
+			return fmt.Errorf("reading audit log: %w", err)
+		}
+		defer f.Close()
+
+		// bufio.Reader doesn't latch EOF, so reading on picks up appends
+		r := bufio.NewReader(f)
+		var partial []byte
+		for {
+			if partial, err = readAudit(r, partial, filter, asJSON); err != nil {
+				return fmt.Errorf("reading audit log: %w", err)
+			}
+			if !follow {
+				return nil
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+	},
+}
+
+func init() {
+	auditCmd.Flags().String("secret", "", "only show entries for this secret")
+	auditCmd.Flags().String("since", "", "only show entries from this long ago, e.g. 24h or 7d")
+	auditCmd.Flags().BoolP("follow", "f", false, "keep printing new entries as they are logged")
+	auditCmd.Flags().Bool("json", false, "print entries as JSON lines")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Backend is a source of secret values. Names are passed with any routing
+// prefix already removed.
+type Backend interface {
+	Get(name string) ([]byte, error)
+}
+
+// backends holds the available backends by the kind name config refers to.
+// Additional backends add themselves with registerBackend from an init
+// function.
+var backends = map[string]Backend{
+	"age": ageBackend{},
+}
+
+func registerBackend(kind string, b Backend) {
+	backends[kind] = b
+}
+
+// ageBackend reads the age-encrypted files in the secrets directory.
+type ageBackend struct{}
+
+func (ageBackend) Get(name string) ([]byte, error) {
+	_, path, err := resolveSecret(name)
+	if err != nil {
+		return nil, err
+	}
+	content, err := decryptSecret(path)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting secret: %w", err)
+	}
+	return []byte(content), nil
+}
+
+// backendFor picks the backend for name using the longest matching prefix
+// from the backends config, and returns the name with that prefix removed.
+// Names no prefix matches are age files.
+func backendFor(name string) (Backend, string, error) {
+	var prefixes []string
+	for p := range cfg.Backends {
+		if strings.HasPrefix(name, p) {
+			prefixes = append(prefixes, p)
+		}
+	}
+	if len(prefixes) == 0 {
+		return ageBackend{}, name, nil
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	prefix := prefixes[0]
+	kind := cfg.Backends[prefix]
+	b, ok := backends[kind]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown backend %q configured for prefix %q", kind, prefix)
+	}
+	return b, strings.TrimPrefix(name, prefix), nil
+}
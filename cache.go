@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+)
+
+// The get cache keeps decrypted values for a short time so that repeated
+// calls don't each need the identity (or a hardware key touch). Entries are
+// encrypted to a key kept next to them, which mostly keeps plaintext out of
+// backups and swap-to-disk tmp directories; the directory permissions are
+// what actually protect it. Each entry's modification time is set to its
+// expiry.
+
+// cacheDir returns the per-user cache directory, preferring the runtime
+// directory, which is usually memory-backed and cleared at logout.
+func cacheDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "secrets")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("secrets-%d", os.Getuid()))
+}
+
+// makeCacheDir makes sure the cache directory exists and is private.
+func makeCacheDir() (string, error) {
+	dir := cacheDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("creating cache directory: %w", err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() || info.Mode().Perm() != 0700 {
+		return "", fmt.Errorf("refusing to use cache directory %s: must be a directory with mode 0700", dir)
+	}
+	return dir, nil
+}
+
+// openCache makes sure the cache directory exists and is private, and
+// returns its key, creating one on first use.
+func openCache() (*age.X25519Identity, error) {
+	dir, err := makeCacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	keyFile := filepath.Join(dir, "key")
+	data, err := ioutil.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		identity, err := age.GenerateX25519Identity()
+		if err != nil {
+			return nil, fmt.Errorf("generating cache key: %w", err)
+		}
+		if err := writeIdentity(keyFile, identity); err != nil {
+			return nil, err
+		}
+		return identity, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading cache key: %w", err)
+	}
+	identities, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil || len(identities) != 1 {
+		return nil, fmt.Errorf("cache key %s is unreadable; run 'secrets lock'", keyFile)
+	}
+	identity, ok := identities[0].(*age.X25519Identity)
+	if !ok {
+		return nil, fmt.Errorf("cache key %s is unreadable; run 'secrets lock'", keyFile)
+	}
+	return identity, nil
+}
+
+// cacheEntry names the entry for the secret at path.
+func cacheEntry(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(cacheDir(), hex.EncodeToString(sum[:])+".age")
+}
+
+// cachedSecret returns the cached value of the secret at path if there is
+// an unexpired entry made from the file as it is now.
+func cachedSecret(path string) (string, bool) {
+	pruneCache()
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	entry := cacheEntry(path)
+	data, err := ioutil.ReadFile(entry)
+	if err != nil {
+		return "", false
+	}
+	identity, err := openCache()
+	if err != nil {
+		printVerbose("Not using cache: %v\n", err)
+		return "", false
+	}
+	r, err := age.Decrypt(bytes.NewReader(data), identity)
+	if err != nil {
+		os.Remove(entry)
+		return "", false
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		os.Remove(entry)
+		return "", false
+	}
+
+	// The first line records the mtime of the file the value came from
+	stamp, content, _ := strings.Cut(string(plain), "\n")
+	if n, err := strconv.ParseInt(stamp, 10, 64); err != nil || n != info.ModTime().UnixNano() {
+		os.Remove(entry)
+		return "", false
+	}
+	printVerbose("Using cached value of %s\n", path)
+	return content, true
+}
+
+// cacheSecret stores content as the value of the secret at path for ttl.
+func cacheSecret(path, content string, ttl time.Duration) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	identity, err := openCache()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, identity.Recipient())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d\n", info.ModTime().UnixNano())
+	io.WriteString(w, content)
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	entry := cacheEntry(path)
+	tmpPath := entry + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	expiry := time.Now().Add(ttl)
+	if err := os.Chtimes(tmpPath, expiry, expiry); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, entry)
+}
+
+// pruneCache removes expired entries.
+func pruneCache() {
+	entries, err := os.ReadDir(cacheDir())
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".age") {
+			continue
+		}
+		if info, err := e.Info(); err == nil && info.ModTime().Before(now) {
+			os.Remove(filepath.Join(cacheDir(), e.Name()))
+		}
+	}
+}
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Clear values cached by get --cache-ttl, and the header cache",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := os.RemoveAll(cacheDir()); err != nil {
+			return fmt.Errorf("clearing cache: %w", err)
+		}
+		printStatus("✓ Cache cleared\n")
+		return nil
+	},
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// clipboardTool is a pair of commands that write stdin to the clipboard and
+// print its contents.
+type clipboardTool struct {
+	copy, paste []string
+}
+
+var clipboardTools = []clipboardTool{
+	{[]string{"wl-copy"}, []string{"wl-paste", "-n"}},
+	{[]string{"xclip", "-selection", "clipboard"}, []string{"xclip", "-selection", "clipboard", "-o"}},
+	{[]string{"xsel", "--clipboard", "--input"}, []string{"xsel", "--clipboard", "--output"}},
+	{[]string{"pbcopy"}, []string{"pbpaste"}},
+}
+
+// findClipboard picks the first available clipboard tool. wl-copy only
+// works inside a Wayland session, so it is skipped elsewhere in favour of
+// the X11 tools.
+func findClipboard() (clipboardTool, error) {
+	for _, t := range clipboardTools {
+		if t.copy[0] == "wl-copy" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			continue
+		}
+		if _, err := exec.LookPath(t.copy[0]); err == nil {
+			return t, nil
+		}
+	}
+	return clipboardTool{}, errors.New("no clipboard tool found; install wl-clipboard, xclip or xsel")
+}
+
+func (t clipboardTool) write(content string) error {
+	return withRetry(t.copy[0], func() error {
+		cmd := exec.Command(t.copy[0], t.copy[1:]...)
+		cmd.Stdin = strings.NewReader(content)
+		return cmd.Run()
+	})
+}
+
+func (t clipboardTool) read() (string, error) {
+	var out bytes.Buffer
+	cmd := exec.Command(t.paste[0], t.paste[1:]...)
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func clipboardDigest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// scheduleClipboardClear starts a detached copy of this binary that clears
+// the clipboard after delay, as this process exits long before then. Only
+// a digest of the content is handed over, through the environment, so the
+// helper can leave the clipboard alone if something else was copied since.
+func scheduleClipboardClear(content string, delay time.Duration) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(self, "__clear-clipboard", "--after", delay.String())
+	cmd.Env = append(os.Environ(), "SECRETS_CLIPBOARD_SHA256="+clipboardDigest(content))
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+var clearClipboardCmd = &cobra.Command{
+	Use:    "__clear-clipboard",
+	Hidden: true,
+	Args:   usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Outlive the terminal that started us
+		signal.Ignore(syscall.SIGHUP, syscall.SIGINT)
+
+		after, _ := cmd.Flags().GetDuration("after")
+		want := os.Getenv("SECRETS_CLIPBOARD_SHA256")
+		time.Sleep(after)
+
+		t, err := findClipboard()
+		if err != nil {
+			return err
+		}
+		current, err := t.read()
+		if err != nil {
+			return err
+		}
+		if clipboardDigest(current) != want {
+			return nil
+		}
+		return t.write("")
+	},
+}
+
+var copyCmd = &cobra.Command{
+	Use:               "copy [secret-name]",
+	Short:             "Copy a secret to the clipboard and clear it after a while",
+	Args:              usageArgs(cobra.ExactArgs(1)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clearAfter, _ := cmd.Flags().GetDuration("clear-after")
+
+		backend, name, err := backendFor(args[0])
+		if err != nil {
+			return err
+		}
+		if _, ok := backend.(ageBackend); ok {
+			confirmed, _ := cmd.Flags().GetBool("confirm")
+			if err := confirmReveal(name, confirmed); err != nil {
+				return err
+			}
+		}
+		t, err := findClipboard()
+		if err != nil {
+			return err
+		}
+		data, err := backend.Get(name)
+		if err != nil {
+			return err
+		}
+		content := string(data)
+		if err := t.write(content); err != nil {
+			return fmt.Errorf("copying to clipboard: %w", err)
+		}
+		if _, ok := backend.(ageBackend); ok {
+			secretName, secretPath, _ := resolveSecret(name)
+			recordAudit("copy", secretName)
+			warnIfStale(secretPath)
+		}
+
+		if clearAfter <= 0 {
+			printStatus("✓ Copied %s to the clipboard\n", args[0])
+			return nil
+		}
+		if err := scheduleClipboardClear(content, clearAfter); err != nil {
+			return fmt.Errorf("scheduling clipboard clear: %w", err)
+		}
+		printStatus("✓ Copied %s to the clipboard; clearing in %s\n", args[0], clearAfter)
+		return nil
+	},
+}
+
+func init() {
+	copyCmd.Flags().Duration("clear-after", 45*time.Second, "clear the clipboard after this long if it still holds the secret (0 to keep it)")
+	copyCmd.Flags().Bool("confirm", false, "copy a protected secret without asking")
+	clearClipboardCmd.Flags().Duration("after", 0, "")
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config holds settings read from the JSON config file. Command-line flags
+// take precedence over anything set here.
+type config struct {
+	// PostHook is a shell command run after a successful mutation.
+	PostHook string `json:"post_hook"`
+	// RecipientsCommand, when set, is run and its output used in place of
+	// the recipients file.
+	RecipientsCommand string `json:"recipients_command"`
+	// RecipientsFiles replaces the default recipients file with several
+	// files whose recipients are merged.
+	RecipientsFiles []string `json:"recipients_files"`
+	// RecipientsHistory is a file in the recipients format listing former
+	// recipients, whose comments name them in status output.
+	RecipientsHistory string `json:"recipients_history"`
+	// RequireSelf makes encrypting fail when the identity's own public key
+	// is not a recipient; it is on unless set to false.
+	RequireSelf *bool `json:"require_self"`
+	// Trash makes remove move secrets to .trash rather than delete them;
+	// it is on unless set to false.
+	Trash *bool `json:"trash"`
+	// AuditLog is a file that records every access to and change of a
+	// secret, as JSON lines.
+	AuditLog string `json:"audit_log"`
+	// GithubAgeKeys is an owner/repo/path, with {user} standing for the
+	// login, from which recipients import github reads age keys.
+	GithubAgeKeys string `json:"github_age_keys"`
+	// SyncTool is "rclone" (the default) or "git", and SyncRemote the rclone
+	// remote path or git remote that sync pushes to and pulls from.
+	SyncTool   string `json:"sync_tool"`
+	SyncRemote string `json:"sync_remote"`
+	// WarnAfter makes get warn about secrets not modified for this long.
+	WarnAfter duration `json:"warn_after"`
+	// Backends maps secret name prefixes to the kind of backend that
+	// serves them, e.g. "vault/": "vault".
+	Backends map[string]string `json:"backends"`
+	// MinRecipients refuses to encrypt to fewer recipients than this, so
+	// losing one key cannot lose a secret.
+	MinRecipients int `json:"min_recipients"`
+	// RecordRecipients writes a .recipients sidecar next to each secret
+	// encrypted, as --record-recipients does.
+	RecordRecipients bool `json:"record_recipients"`
+	// ConfirmRecipients makes add and edit list the recipients and ask
+	// before encrypting, as --confirm-recipients does.
+	ConfirmRecipients bool `json:"confirm_recipients"`
+	// RekeyOnAdd makes add warn about other secrets whose recipients have
+	// drifted, as --check-drift does. Nothing is rekeyed.
+	RekeyOnAdd bool `json:"rekey_on_add"`
+	// SecretMode and DirMode are the permissions of secret files and of
+	// the directories created for them, 0600 and 0700 if unset.
+	SecretMode fileMode `json:"secret_mode"`
+	DirMode    fileMode `json:"dir_mode"`
+	// NamePattern is a regular expression new secret names, without .age,
+	// must match; ReservedNames are names no new secret may take.
+	NamePattern   string   `json:"name_pattern"`
+	ReservedNames []string `json:"reserved_names"`
+	// Profiles are named stores, one of which --profile or
+	// $SECRETS_PROFILE selects.
+	Profiles map[string]profile `json:"profiles"`
+
+	// namePattern is NamePattern compiled, or the default pattern.
+	namePattern *regexp.Regexp
+}
+
+// duration is a time.Duration read from a JSON string such as "90d" or
+// "36h". Days are accepted in addition to the units of time.ParseDuration.
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"90d\": %w", err)
+	}
+	v, err := parseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// parseDuration extends time.ParseDuration with a "d" suffix for days.
+func parseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// fileMode is a permission read from a JSON string of octal digits such as
+// "0640".
+type fileMode os.FileMode
+
+func (m *fileMode) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("mode must be a string like \"0640\": %w", err)
+	}
+	v, err := parseFileMode(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func parseFileMode(s string) (fileMode, error) {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 0777 {
+		return 0, fmt.Errorf("invalid mode %q: want octal permissions such as 0640", s)
+	}
+	return fileMode(v), nil
+}
+
+// checkOwnerMode fails unless the owner has all of the need permissions,
+// without which the store could not update its own files.
+func checkOwnerMode(m fileMode, need os.FileMode) error {
+	if os.FileMode(m)&need != need {
+		return fmt.Errorf("invalid mode %04o: the owner needs at least %04o", m, need)
+	}
+	return nil
+}
+
+// secretFileMode is the permission secret files are written with.
+func secretFileMode() os.FileMode {
+	if cfg.SecretMode != 0 {
+		return os.FileMode(cfg.SecretMode)
+	}
+	return 0600
+}
+
+// secretDirMode is the permission of the secrets directory and the
+// namespace directories in it.
+func secretDirMode() os.FileMode {
+	if cfg.DirMode != 0 {
+		return os.FileMode(cfg.DirMode)
+	}
+	return 0700
+}
+
+var cfg config
+
+// modeFlag is bound to --mode, which overrides secret_mode.
+var modeFlag string
+
+// configPath returns $SECRETS_CONFIG, or config.json under the user's
+// configuration directory.
+func configPath() string {
+	if p := os.Getenv("SECRETS_CONFIG"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "secrets", "config.json")
+}
+
+// loadConfig reads the config file. A missing file yields the zero config.
+func loadConfig() (config, error) {
+	var c config
+	path := configPath()
+	if path == "" {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("reading config: %w", err)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	if c.SecretMode != 0 {
+		if err := checkOwnerMode(c.SecretMode, 0600); err != nil {
+			return c, fmt.Errorf("config %s: secret_mode: %w", path, err)
+		}
+	}
+	if c.DirMode != 0 {
+		if err := checkOwnerMode(c.DirMode, 0700); err != nil {
+			return c, fmt.Errorf("config %s: dir_mode: %w", path, err)
+		}
+	}
+	if c.NamePattern != "" {
+		if c.namePattern, err = regexp.Compile(c.NamePattern); err != nil {
+			return c, fmt.Errorf("config %s: name_pattern: %w", path, err)
+		}
+	}
+	return c, nil
+}
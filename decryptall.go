@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var decryptAllCmd = &cobra.Command{
+	Use:   "decrypt-all",
+	Short: "Write every secret as a plaintext file under a directory",
+	Long: `Write every secret as a plaintext file under --output-dir, mirroring the
+namespace tree and dropping the .age suffix. This is meant for migrating away
+from the store; the output is unencrypted.`,
+	Args: usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outDir, _ := cmd.Flags().GetString("output-dir")
+		understood, _ := cmd.Flags().GetBool("i-understand-plaintext")
+		force, _ := cmd.Flags().GetBool("force")
+		if outDir == "" {
+			return fmt.Errorf("%w: --output-dir is required", ErrUsage)
+		}
+		if !understood {
+			return fmt.Errorf("%w: this writes every secret unencrypted; pass --i-understand-plaintext to continue", ErrUsage)
+		}
+		if repo := enclosingRepo(outDir); repo != "" && !force {
+			return fmt.Errorf("%s is inside the git repository %s, where plaintext could be committed; pass --force to write there anyway", outDir, repo)
+		}
+
+		names, excluded, err := excludeSecrets(getSecretNames())
+		if err != nil {
+			return err
+		}
+		res := bulkResult{Excluded: excluded}
+		for _, name := range names {
+			if err := decryptTo(name, outDir); err != nil {
+				res.fail(name, err)
+				continue
+			}
+			res.Processed = append(res.Processed, name)
+		}
+		for _, name := range res.Failed {
+			printWarning("✗ %s: %v\n", displayName(name), res.Errors[name])
+		}
+		printStatus("✓ Wrote %d secrets to %s%s\n", len(res.Processed), outDir, excludedNote(res.Excluded))
+		if len(res.Failed) > 0 {
+			return fmt.Errorf("%d secrets could not be written: %s", len(res.Failed), strings.Join(displayNames(res.Failed), ", "))
+		}
+		return nil
+	},
+}
+
+// decryptTo writes the plaintext of secret name to its place under outDir.
+func decryptTo(name, outDir string) error {
+	content, err := decryptSecret(filepath.Join(secretsDir, filepath.FromSlash(name)))
+	if err != nil {
+		return fmt.Errorf("decrypting secret: %w", err)
+	}
+	path := filepath.Join(outDir, filepath.FromSlash(strings.TrimSuffix(name, ".age")))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// An existing file keeps its mode otherwise
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// enclosingRepo returns the root of the git work tree containing dir, which
+// need not exist yet, or "" if there is none.
+func enclosingRepo(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(abs, ".git")); err == nil {
+			return abs
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return ""
+		}
+		abs = parent
+	}
+}
+
+func init() {
+	decryptAllCmd.Flags().String("output-dir", "", "directory to write the plaintext files to")
+	decryptAllCmd.Flags().Bool("i-understand-plaintext", false, "acknowledge that the output is unencrypted")
+	decryptAllCmd.Flags().Bool("force", false, "write even inside a git repository")
+	decryptAllCmd.MarkFlagDirname("output-dir")
+}
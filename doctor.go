@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that age and the store are set up correctly",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fix, _ := cmd.Flags().GetBool("fix")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		failed := 0
+		report := doctorReport{Checks: []doctorCheck{}}
+		check := func(name string, ok bool, format string, a ...interface{}) {
+			mark, status := "✓", "ok"
+			if !ok {
+				mark, status = "✗", "fail"
+				failed++
+			}
+			if asJSON {
+				report.Checks = append(report.Checks, doctorCheck{name, status, fmt.Sprintf(format, a...)})
+				return
+			}
+			fmt.Printf(mark+" "+format+"\n", a...)
+		}
+
+		info, err := detectAge()
+		if err != nil {
+			check("age", false, "age: %v", err)
+		} else {
+			check("age", true, "age %s (%s)", info.Version, info.Path)
+		}
+
+		if ids, ok, err := memoryIdentities(); ok {
+			check("identity", err == nil && len(ids) > 0, "in-memory identity")
+		} else {
+			keyPath := identityPath()
+			_, err = os.Stat(keyPath)
+			check("identity", err == nil, "identity file %s", keyPath)
+		}
+
+		recipients, err := effectiveRecipients()
+		switch {
+		case err != nil:
+			check("recipients", false, "%s: %v", recipientsSource(), err)
+		case len(recipients) == 0:
+			check("recipients", false, "%s has no recipients", recipientsSource())
+		default:
+			check("recipients", true, "%s (%d recipients)", recipientsSource(), len(recipients))
+			if err := checkRecipientFeatures(recipients); err != nil {
+				check("recipient_features", false, "%v", err)
+			}
+		}
+
+		if _, err := os.Stat(secretsDir); err != nil {
+			check("secrets_dir", false, "secrets directory: %v", err)
+		} else {
+			check("secrets_dir", true, "secrets directory %s (%d secrets)", secretsDir, len(getSecretNames()))
+		}
+
+		// Windows has no Unix permission bits to check
+		if runtime.GOOS != "windows" {
+			// A missing identity file was already reported above
+			if _, err := os.Stat(identityPath()); err == nil {
+				ok, msg := checkMode(identityPath(), 0600, fix)
+				check("identity_permissions", ok, "identity file permissions: %s", msg)
+			}
+			ok, msg := checkMode(secretsDir, secretDirMode(), fix)
+			check("secrets_dir_permissions", ok, "secrets directory permissions: %s", msg)
+
+			var loose []string
+			for _, name := range getSecretNames() {
+				if ok, _ := checkMode(filepath.Join(secretsDir, filepath.FromSlash(name)), secretFileMode(), fix); !ok {
+					loose = append(loose, name)
+				}
+			}
+			switch {
+			case len(loose) == 0 && fix:
+				check("secret_permissions", true, "secret file permissions are at most %04o", secretFileMode())
+			case len(loose) == 0:
+				check("secret_permissions", true, "no secret is more open than %04o", secretFileMode())
+			default:
+				check("secret_permissions", false, "%d secrets are more open than %04o (run doctor --fix): %s", len(loose), secretFileMode(), strings.Join(loose, ", "))
+			}
+		}
+
+		// Last, as it sums up everything above
+		if err := roundTrip(); err != nil {
+			check("round_trip", false, "round trip: %v", err)
+		} else {
+			check("round_trip", true, "round trip: a test value encrypted to the recipients decrypts with the identity")
+		}
+
+		if asJSON {
+			report.OK = failed == 0
+			out, err := encodeJSON(report)
+			if err != nil {
+				return err
+			}
+			fmt.Println(out)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d checks failed", failed)
+		}
+		return nil
+	},
+}
+
+// doctorReport is the output of doctor --json.
+type doctorReport struct {
+	OK     bool          `json:"ok"`
+	Checks []doctorCheck `json:"checks"`
+}
+
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// roundTrip encrypts a random value to the current recipients and decrypts
+// it with the identity, all in memory, to catch a configuration where new
+// secrets couldn't be read back.
+func roundTrip() error {
+	value := make([]byte, 16)
+	if _, err := rand.Read(value); err != nil {
+		return err
+	}
+	want := hex.EncodeToString(value)
+
+	args, err := recipientArgs()
+	if err != nil {
+		return fmt.Errorf("reading recipients: %w", err)
+	}
+	var ciphertext, stderr bytes.Buffer
+	cmd, err := ageCommand(args...)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = strings.NewReader(want)
+	cmd.Stdout = &ciphertext
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("encrypting: %w", ageError(err, stderr.Bytes(), errEncrypt))
+	}
+
+	got, err := decryptData(ciphertext.Bytes(), "the test message")
+	if err != nil {
+		return fmt.Errorf("the identity cannot decrypt it; is its public key among the recipients? %w", err)
+	}
+	if got != want {
+		return errors.New("decrypted value does not match what was encrypted")
+	}
+	return nil
+}
+
+// checkMode reports whether path grants no more than the permissions in max.
+// With fix, extra bits are removed instead of reported.
+func checkMode(path string, max os.FileMode, fix bool) (bool, string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err.Error()
+	}
+	mode := info.Mode().Perm()
+	if mode&^max == 0 {
+		return true, fmt.Sprintf("%s is %04o", path, mode)
+	}
+	if !fix {
+		return false, fmt.Sprintf("%s is %04o, should be at most %04o (run doctor --fix)", path, mode, max)
+	}
+	if err := os.Chmod(path, mode&max); err != nil {
+		return false, fmt.Sprintf("tightening %s: %v", path, err)
+	}
+	return true, fmt.Sprintf("%s tightened from %04o to %04o", path, mode, mode&max)
+}
+
+func init() {
+	doctorCmd.Flags().Bool("fix", false, "tighten permissions that are too open")
+	doctorCmd.Flags().Bool("json", false, "print the checks as JSON, each with a name, status and detail")
+}
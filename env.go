@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var envCmd = &cobra.Command{
+	Use:     "env [prefix]",
+	Aliases: []string{"export"},
+	Short:   "Print export lines for secrets under a prefix, for use with eval",
+	Long: `Print export lines for every secret whose name starts with prefix, e.g.
+
+  eval "$(secrets env myapp/)"
+  secrets env --format fish myapp/ | source
+
+The variable name is the last component of the secret name, uppercased, so
+myapp/db-password becomes DB_PASSWORD. --format shell prints export lines for
+bash, zsh and other POSIX shells, fish prints set -gx lines, and auto picks
+one of the two from $SHELL. Values are quoted so that any content, newlines
+included, comes through as it is.`,
+	Args:              usageArgs(cobra.MaximumNArgs(1)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		unset, _ := cmd.Flags().GetBool("unset")
+		format, _ := cmd.Flags().GetString("format")
+		if format == "auto" {
+			format = "shell"
+			if filepath.Base(os.Getenv("SHELL")) == "fish" {
+				format = "fish"
+			}
+		}
+		if format != "shell" && format != "fish" {
+			return fmt.Errorf("%w: --format must be shell, fish or auto", ErrUsage)
+		}
+		prefix := ""
+		if len(args) == 1 {
+			prefix = args[0]
+		}
+
+		// Collect everything first so a failure never emits a partial script
+		var out strings.Builder
+		seen := map[string]string{}
+		for _, name := range getSecretNames() {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			key := envVarName(name)
+			if other, ok := seen[key]; ok {
+				return fmt.Errorf("%s and %s both map to %s", displayName(other), displayName(name), key)
+			}
+			seen[key] = name
+
+			if unset {
+				if format == "fish" {
+					fmt.Fprintf(&out, "set -e %s\n", key)
+				} else {
+					fmt.Fprintf(&out, "unset %s\n", key)
+				}
+				continue
+			}
+			content, err := decryptSecret(filepath.Join(secretsDir, filepath.FromSlash(name)))
+			if err != nil {
+				return fmt.Errorf("decrypting %s: %w", displayName(name), err)
+			}
+			value := strings.TrimSuffix(content, "\n")
+			if format == "fish" {
+				fmt.Fprintf(&out, "set -gx %s %s\n", key, fishQuote(value))
+			} else {
+				fmt.Fprintf(&out, "export %s=%s\n", key, shellQuote(value))
+			}
+		}
+		if len(seen) == 0 {
+			return fmt.Errorf("%w: no secrets match %q", ErrSecretNotFound, prefix)
+		}
+		fmt.Print(out.String())
+		return nil
+	},
+}
+
+// envVarName derives an environment variable name from the last component of
+// a secret name: uppercased, with anything outside [A-Z0-9_] replaced by _.
+func envVarName(name string) string {
+	base := strings.TrimSuffix(path.Base(name), ".age")
+	key := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, base)
+	if key == "" || (key[0] >= '0' && key[0] <= '9') {
+		key = "_" + key
+	}
+	return key
+}
+
+// shellQuote wraps s in single quotes for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fishQuote wraps s in single quotes for fish, where backslashes and single
+// quotes need escaping inside them.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func init() {
+	envCmd.Flags().Bool("unset", false, "print unset lines instead, without decrypting")
+	envCmd.Flags().String("format", "shell", "shell, fish, or auto to pick one from $SHELL")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// Sentinel errors returned by commands. main maps them to exit codes so that
+// scripts can branch on the kind of failure.
+var (
+	ErrUsage          = errors.New("usage error")
+	ErrSecretNotFound = errors.New("secret not found")
+	ErrDecrypt        = errors.New("decryption failed")
+	ErrAgeNotFound    = errors.New("age binary not found")
+
+	// errEncrypt has no dedicated exit code and maps to the generic one.
+	errEncrypt = errors.New("encryption failed")
+	// errAbsent is how exists answers no: the generic exit code, and no
+	// message, since the exit code is the whole answer.
+	errAbsent = errors.New("secret does not exist")
+)
+
+// Exit codes, documented in the README.
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitNotFound    = 3
+	exitDecrypt     = 4
+	exitAgeNotFound = 5
+)
+
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, ErrUsage):
+		return exitUsage
+	case errors.Is(err, ErrSecretNotFound):
+		return exitNotFound
+	case errors.Is(err, ErrDecrypt):
+		return exitDecrypt
+	case errors.Is(err, ErrAgeNotFound):
+		return exitAgeNotFound
+	default:
+		return exitError
+	}
+}
+
+// usageArgs wraps a cobra argument validator so its failures carry ErrUsage.
+func usageArgs(fn cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := fn(cmd, args); err != nil {
+			return fmt.Errorf("%w: %v", ErrUsage, err)
+		}
+		return nil
+	}
+}
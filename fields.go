@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Secrets may hold a password on the first line followed by "key: value"
+// lines, as pass does. set and unset change one of those fields and leave
+// every other line as it was; the first line is the "password" field.
+const passwordField = "password"
+
+// showFieldDiff and revealFieldDiff are the --show-diff and --reveal flags
+// of set and unset.
+var showFieldDiff, revealFieldDiff bool
+
+var setCmd = &cobra.Command{
+	Use:   "set [secret-name] [field] [value]",
+	Short: "Set one key: value field of a secret",
+	Long: `Set a "key: value" line of a secret, replacing the first line with that key
+or appending one, without touching the other lines. The field "password" is
+the first line. Without a value argument, it is read from stdin.
+
+--show-diff prints the line that changed, with the values masked unless
+--reveal is given.`,
+	Args:              usageArgs(cobra.RangeArgs(2, 3)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		field := args[1]
+		if err := validateField(field); err != nil {
+			return err
+		}
+		var value string
+		if len(args) == 3 {
+			value = args[2]
+		} else {
+			if isTerminal(os.Stdin) {
+				fmt.Fprintf(os.Stderr, "Value for %s: ", field)
+			}
+			scanner := bufio.NewScanner(os.Stdin)
+			scanner.Scan()
+			if err := scanner.Err(); err != nil {
+				return fmt.Errorf("reading value: %w", err)
+			}
+			value = scanner.Text()
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%w: a field value cannot span lines", ErrUsage)
+		}
+		return updateField(args[0], field, "set", func(lines []string) ([]string, error) {
+			return setField(lines, field, value), nil
+		})
+	},
+}
+
+var unsetCmd = &cobra.Command{
+	Use:   "unset [secret-name] [field]",
+	Short: "Remove one key: value field from a secret",
+	Long: `Remove the "key: value" line with the given key from a secret, leaving the
+other lines as they were. Unsetting "password" empties the first line.
+--show-diff prints the line removed, masked unless --reveal is given.`,
+	Args:              usageArgs(cobra.ExactArgs(2)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		field := args[1]
+		if err := validateField(field); err != nil {
+			return err
+		}
+		return updateField(args[0], field, "unset", func(lines []string) ([]string, error) {
+			lines, ok := unsetField(lines, field)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s has no field %q", ErrSecretNotFound, args[0], field)
+			}
+			return lines, nil
+		})
+	},
+}
+
+func validateField(field string) error {
+	if field == "" || strings.ContainsAny(field, ":\r\n") || strings.TrimSpace(field) != field {
+		return fmt.Errorf("%w: invalid field name %q", ErrUsage, field)
+	}
+	return nil
+}
+
+// updateField decrypts secret name, applies change to its lines and
+// encrypts the result the way it was encrypted before.
+func updateField(name, field, op string, change func([]string) ([]string, error)) error {
+	secretName, secretPath, err := resolveSecret(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(secretPath); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrSecretNotFound, displayName(secretName))
+	}
+	content, err := decryptSecret(secretPath)
+	if err != nil {
+		return fmt.Errorf("decrypting secret: %w", err)
+	}
+	if isBinary(content) {
+		return fmt.Errorf("%w: %s holds binary data, which has no fields", ErrUsage, displayName(secretName))
+	}
+
+	// Keep a final newline, or its absence, as it was
+	trailing := strings.HasSuffix(content, "\n")
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	before, hadField := fieldValue(lines, field)
+	lines, err = change(lines)
+	if err != nil {
+		return err
+	}
+	updated := strings.Join(lines, "\n")
+	if trailing {
+		updated += "\n"
+	}
+	if updated == content {
+		printStatus("✓ Field '%s' of '%s' is unchanged\n", field, displayName(secretName))
+		return nil
+	}
+	after, hasField := fieldValue(lines, field)
+	if dryRun {
+		printDryRun("%s %s in %s", op, field, secretPath)
+		printFieldDiff(field, before, hadField, after, hasField)
+		return nil
+	}
+
+	if passphrase, ok := secretPassphrases[secretPath]; ok {
+		err = encryptWithPassphrase(updated, secretPath, passphrase)
+	} else {
+		err = encryptSecret(updated, secretPath)
+	}
+	if err != nil {
+		return fmt.Errorf("encrypting secret: %w", err)
+	}
+	if op == "unset" {
+		printStatus("✓ Field '%s' removed from '%s'\n", field, displayName(secretName))
+	} else {
+		printStatus("✓ Field '%s' of '%s' set\n", field, displayName(secretName))
+	}
+	printFieldDiff(field, before, hadField, after, hasField)
+	return runHook(op, secretName)
+}
+
+// fieldLine returns the index of the first "field: value" line after the
+// first line, or -1.
+func fieldLine(lines []string, field string) int {
+	for i := 1; i < len(lines); i++ {
+		if key, _, ok := strings.Cut(lines[i], ":"); ok && strings.TrimSpace(key) == field {
+			return i
+		}
+	}
+	return -1
+}
+
+// fieldValue returns the value of field, and whether the secret has it.
+func fieldValue(lines []string, field string) (string, bool) {
+	if field == passwordField {
+		return lines[0], lines[0] != ""
+	}
+	i := fieldLine(lines, field)
+	if i < 0 {
+		return "", false
+	}
+	_, value, _ := strings.Cut(lines[i], ":")
+	return strings.TrimSpace(value), true
+}
+
+// printFieldDiff prints the change to field for --show-diff, as removed and
+// added lines. Values are masked with a fixed-length mask, which gives away
+// neither the value nor its length, unless --reveal is set.
+func printFieldDiff(field, before string, had bool, after string, has bool) {
+	if !showFieldDiff {
+		return
+	}
+	show := func(value string) string {
+		if revealFieldDiff {
+			return value
+		}
+		return "********"
+	}
+	if had {
+		fmt.Printf("- %s: %s\n", field, show(before))
+	}
+	if has {
+		fmt.Printf("+ %s: %s\n", field, show(after))
+	}
+}
+
+func setField(lines []string, field, value string) []string {
+	if field == passwordField {
+		lines[0] = value
+		return lines
+	}
+	if i := fieldLine(lines, field); i >= 0 {
+		lines[i] = field + ": " + value
+		return lines
+	}
+	return append(lines, field+": "+value)
+}
+
+func unsetField(lines []string, field string) ([]string, bool) {
+	if field == passwordField {
+		ok := lines[0] != ""
+		lines[0] = ""
+		return lines, ok
+	}
+	i := fieldLine(lines, field)
+	if i < 0 {
+		return lines, false
+	}
+	return append(lines[:i], lines[i+1:]...), true
+}
+
+func init() {
+	for _, c := range []*cobra.Command{setCmd, unsetCmd} {
+		c.Flags().BoolVar(&showFieldDiff, "show-diff", false, "print the field line that changed, with values masked")
+		c.Flags().BoolVar(&revealFieldDiff, "reveal", false, "show the values in --show-diff instead of masking them")
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+func writeFifo(value string, timeout time.Duration) error {
+	return errors.New("get --fifo needs named pipes, which this system does not have")
+}
@@ -0,0 +1,58 @@
+//go:build unix
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// writeFifo hands value to one reader through a named pipe in the cache
+// directory, so it never lands in a regular file. The pipe's path is
+// printed for the reader and the pipe removed as soon as the reader has
+// opened it, so no one else can. Without a reader within timeout, nothing
+// is written.
+func writeFifo(value string, timeout time.Duration) error {
+	dir, err := makeCacheDir()
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "get-"+hex.EncodeToString(b)+".fifo")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		return fmt.Errorf("creating named pipe: %w", err)
+	}
+	defer os.Remove(path)
+	fmt.Println(path)
+
+	// Opening for writing without blocking fails until a reader has the
+	// pipe open
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			os.Remove(path)
+			_, err = f.WriteString(value)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			return err
+		}
+		if !errors.Is(err, syscall.ENXIO) {
+			return fmt.Errorf("opening named pipe: %w", err)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no reader opened %s within %s", path, timeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -11,6 +11,7 @@
         version = "1.0.0";
         src = ./.;
         vendorHash = null;
+        ldflags = [ "-X main.version=1.0.0" "-X main.commit=${self.rev or "dirty"}" ];
 
         # Rename binary from go-secrets to secrets
         postInstall = ''
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// hookMarker identifies git hooks written by install-hooks, so that
+// --uninstall and reinstalling never touch hooks of other origin.
+const hookMarker = "# Installed by secrets install-hooks"
+
+var installHooksCmd = &cobra.Command{
+	Use:   "install-hooks",
+	Short: "Install a git pre-commit hook that checks the store",
+	Long: `Install a pre-commit hook in the git repository holding the secrets
+directory. It runs recipients validate and refuses commits that stage a
+file under the secrets directory that is not age-encrypted and looks like
+a plaintext secret. The hook calls back into this binary, with the store's
+paths, so its checks match the installed version.`,
+	Args: usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		uninstall, _ := cmd.Flags().GetBool("uninstall")
+		force, _ := cmd.Flags().GetBool("force")
+
+		out, err := exec.Command("git", "-C", secretsDir, "rev-parse", "--path-format=absolute", "--git-path", "hooks").Output()
+		if err != nil {
+			return fmt.Errorf("%s is not in a git repository", secretsDir)
+		}
+		hookPath := filepath.Join(strings.TrimSpace(string(out)), "pre-commit")
+		existing, err := os.ReadFile(hookPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		ours := bytes.Contains(existing, []byte(hookMarker))
+
+		if uninstall {
+			if existing == nil {
+				printStatus("✓ No pre-commit hook installed\n")
+				return nil
+			}
+			if !ours {
+				return fmt.Errorf("%s was not installed by install-hooks; leaving it", hookPath)
+			}
+			if err := os.Remove(hookPath); err != nil {
+				return err
+			}
+			printStatus("✓ Removed %s\n", hookPath)
+			return nil
+		}
+
+		if existing != nil && !ours && !force {
+			return fmt.Errorf("%s already exists; pass --force to replace it", hookPath)
+		}
+		script, err := preCommitScript()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(hookPath), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(hookPath, []byte(script), 0755); err != nil {
+			return fmt.Errorf("writing hook: %w", err)
+		}
+		printStatus("✓ Installed %s\n", hookPath)
+		return nil
+	},
+}
+
+// preCommitScript returns the pre-commit hook, which runs this binary with
+// absolute paths since git runs hooks from the top of the work tree.
+func preCommitScript() (string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("locating this program: %w", err)
+	}
+	args := []string{shellQuote(self)}
+	dir, err := filepath.Abs(secretsDir)
+	if err != nil {
+		return "", err
+	}
+	args = append(args, "--dir", shellQuote(dir))
+	for _, f := range recipientsFiles {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "--recipients", shellQuote(abs))
+	}
+	args = append(args, "git-hook", "pre-commit")
+	return fmt.Sprintf("#!/bin/sh\n%s; remove with secrets install-hooks --uninstall\nexec %s\n", hookMarker, strings.Join(args, " ")), nil
+}
+
+var gitHookCmd = &cobra.Command{
+	Use:    "git-hook [name]",
+	Short:  "Run a git hook installed by install-hooks",
+	Hidden: true,
+	Args:   usageArgs(cobra.ExactArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if args[0] != "pre-commit" {
+			return fmt.Errorf("%w: unknown hook %q", ErrUsage, args[0])
+		}
+		if _, err := validateRecipientsFiles(); err != nil {
+			return err
+		}
+		suspect, err := stagedPlaintext()
+		if err != nil {
+			return err
+		}
+		for _, path := range suspect {
+			printWarning("✗ %s: not encrypted and looks like a secret\n", path)
+		}
+		if len(suspect) > 0 {
+			return fmt.Errorf("refusing to commit %d plaintext files under %s; unstage them or encrypt them with add", len(suspect), secretsDir)
+		}
+		return nil
+	},
+}
+
+// stagedPlaintext returns the files staged for commit under the secrets
+// directory that are neither age-encrypted nor known store files, and whose
+// content looks like a secret.
+func stagedPlaintext() ([]string, error) {
+	top, err := exec.Command("git", "-C", secretsDir, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, fmt.Errorf("finding the git work tree: %w", err)
+	}
+	root := strings.TrimSpace(string(top))
+	dir, err := filepath.Abs(secretsDir)
+	if err != nil {
+		return nil, err
+	}
+	// Resolve symlinks on both sides, as git reports the real path
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	}
+	prefix, err := filepath.Rel(root, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := exec.Command("git", "-C", root, "diff", "--cached", "--name-only", "--diff-filter=ACMR", "-z", "--", prefix).Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing staged files: %w", err)
+	}
+	var suspect []string
+	for _, path := range strings.Split(strings.TrimRight(string(out), "\x00"), "\x00") {
+		switch filepath.Base(path) {
+		case "", "meta.json", syncStateFile:
+			continue
+		}
+		if strings.HasSuffix(path, ".age"+sidecarSuffix) {
+			continue
+		}
+		content, err := exec.Command("git", "-C", root, "show", ":"+path).Output()
+		if err != nil {
+			return nil, fmt.Errorf("reading staged %s: %w", path, err)
+		}
+		if looksEncrypted(string(content)) {
+			continue
+		}
+		if looksSecret(string(content)) {
+			suspect = append(suspect, path)
+		}
+	}
+	return suspect, nil
+}
+
+// looksSecret reports whether content holds something like a key or
+// password: binary data with high entropy, or text with a long high-entropy
+// token. Prose and configuration mostly don't.
+func looksSecret(content string) bool {
+	if isBinary(content) {
+		return len(content) >= 16 && entropy(content) >= 5
+	}
+	tokens := strings.FieldsFunc(content, func(r rune) bool {
+		return strings.ContainsRune(" \t\r\n=:,;\"'`", r)
+	})
+	for _, t := range tokens {
+		if len(t) >= 16 && entropy(t) >= 3.5 {
+			return true
+		}
+	}
+	return false
+}
+
+// entropy is the Shannon entropy of s in bits per byte.
+func entropy(s string) float64 {
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	var h float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(len(s))
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+func init() {
+	installHooksCmd.Flags().Bool("uninstall", false, "remove the hook again")
+	installHooksCmd.Flags().BoolP("force", "f", false, "replace a pre-commit hook that install-hooks did not write")
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var githubClient = &http.Client{Timeout: 30 * time.Second}
+
+// githubAPI returns the API base URL, which GitHub Actions and GitHub
+// Enterprise set through $GITHUB_API_URL.
+func githubAPI() string {
+	if u := os.Getenv("GITHUB_API_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "https://api.github.com"
+}
+
+// githubGet fetches an API path, authenticating with $GITHUB_TOKEN when set.
+// A 404 returns a nil body and no error.
+func githubGet(path, accept string) ([]byte, error) {
+	req, err := http.NewRequest("GET", githubAPI()+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", "go-secrets")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := githubClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0":
+		return nil, fmt.Errorf("GitHub rate limit reached; set GITHUB_TOKEN")
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("GitHub %s: %s", path, resp.Status)
+	}
+	return body, nil
+}
+
+// githubTeamMembers lists the logins in org/team, following pagination.
+func githubTeamMembers(org, team string) ([]string, error) {
+	var logins []string
+	for page := 1; ; page++ {
+		body, err := githubGet(fmt.Sprintf("/orgs/%s/teams/%s/members?per_page=100&page=%d", url.PathEscape(org), url.PathEscape(team), page), "application/vnd.github+json")
+		if err != nil {
+			return nil, err
+		}
+		if body == nil {
+			return nil, fmt.Errorf("team %s/%s not found; private teams need a GITHUB_TOKEN with read:org", org, team)
+		}
+		var members []struct {
+			Login string `json:"login"`
+		}
+		if err := json.Unmarshal(body, &members); err != nil {
+			return nil, fmt.Errorf("parsing team members: %w", err)
+		}
+		for _, m := range members {
+			logins = append(logins, m.Login)
+		}
+		if len(members) < 100 {
+			return logins, nil
+		}
+	}
+}
+
+// githubKeys returns the public keys of user that age can encrypt to: their
+// SSH keys of a supported type and, with github_age_keys configured, the
+// age keys in that file.
+func githubKeys(user string) ([]string, error) {
+	body, err := githubGet("/users/"+url.PathEscape(user)+"/keys", "application/vnd.github+json")
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, fmt.Errorf("GitHub user %s not found", user)
+	}
+	var sshKeys []struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(body, &sshKeys); err != nil {
+		return nil, fmt.Errorf("parsing keys of %s: %w", user, err)
+	}
+	var keys []string
+	for _, k := range sshKeys {
+		if strings.HasPrefix(k.Key, "ssh-ed25519 ") || strings.HasPrefix(k.Key, "ssh-rsa ") {
+			keys = append(keys, k.Key)
+		} else {
+			printVerbose("Skipping %s key of %s that age cannot use\n", strings.Fields(k.Key)[0], user)
+		}
+	}
+
+	if cfg.GithubAgeKeys == "" {
+		return keys, nil
+	}
+	// owner/repo/path, with {user} standing for the login
+	parts := strings.SplitN(strings.ReplaceAll(cfg.GithubAgeKeys, "{user}", user), "/", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("github_age_keys must be owner/repo/path, got %q", cfg.GithubAgeKeys)
+	}
+	body, err = githubGet(fmt.Sprintf("/repos/%s/%s/contents/%s", parts[0], parts[1], parts[2]), "application/vnd.github.raw")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "age1") {
+			keys = append(keys, line)
+		}
+	}
+	return keys, nil
+}
+
+var recipientsImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Add recipients from an external source",
+}
+
+var recipientsImportGithubCmd = &cobra.Command{
+	Use:   "github [user|org/team...]",
+	Short: "Add the public keys of GitHub users or team members",
+	Long: `Add the SSH keys GitHub users publish, with the username as the comment.
+An org/team argument imports every member of the team. Set GITHUB_TOKEN to
+avoid rate limits and to read private teams.
+
+With github_age_keys set in the config to owner/repo/path, where {user}
+stands for the login, age keys in that file are imported as well.`,
+	Args: usageArgs(cobra.MinimumNArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var users []string
+		for _, arg := range args {
+			if org, team, ok := strings.Cut(arg, "/"); ok {
+				members, err := githubTeamMembers(org, team)
+				if err != nil {
+					return err
+				}
+				users = append(users, members...)
+			} else {
+				users = append(users, arg)
+			}
+		}
+
+		added, present := 0, 0
+		for _, user := range users {
+			keys, err := githubKeys(user)
+			if err != nil {
+				return err
+			}
+			if len(keys) == 0 {
+				printWarning("Warning: %s has no keys age can use\n", user)
+			}
+			for _, key := range keys {
+				ok, err := appendRecipient(key, user)
+				if err != nil {
+					return err
+				}
+				if ok {
+					added++
+				} else {
+					present++
+				}
+			}
+		}
+		printStatus("✓ Added %d recipients (%d already present)\n", added, present)
+		return nil
+	},
+}
+
+func init() {
+	recipientsImportCmd.AddCommand(recipientsImportGithubCmd)
+}
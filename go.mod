@@ -2,9 +2,18 @@ module github.com/jblais493/go-secrets
 
 go 1.25.0
 
-require github.com/spf13/cobra v1.10.1
+require (
+	filippo.io/age v1.2.1
+	github.com/BurntSushi/toml v1.4.0
+	github.com/fsnotify/fsnotify v1.8.0
+	github.com/spf13/cobra v1.10.1
+	golang.org/x/term v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.9 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
 )
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	ageIntro    = "age-encryption.org/v1"
+	armorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+	armorFooter = "-----END AGE ENCRYPTED FILE-----"
+)
+
+// stanza is one recipient entry from an age header.
+type stanza struct {
+	Type string
+	Args []string
+}
+
+// readHeader parses the recipient stanzas of the age file at path without
+// decrypting it. Armored files are supported.
+func readHeader(path string) ([]stanza, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseHeader(data)
+}
+
+func parseHeader(data []byte) ([]stanza, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armorHeader)) {
+		var err error
+		if data, err = dearmor(data); err != nil {
+			return nil, err
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if !scanner.Scan() || scanner.Text() != ageIntro {
+		return nil, errors.New("not an age file")
+	}
+
+	var stanzas []stanza
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "---") {
+			return stanzas, nil
+		}
+		if !strings.HasPrefix(line, "-> ") {
+			return nil, fmt.Errorf("malformed age header line %q", line)
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "-> "))
+		if len(fields) == 0 {
+			return nil, errors.New("malformed age header: empty stanza")
+		}
+		stanzas = append(stanzas, stanza{Type: fields[0], Args: fields[1:]})
+
+		// The stanza body is wrapped at 64 columns and ends with a
+		// shorter, possibly empty, line
+		for scanner.Scan() {
+			if len(scanner.Text()) < 64 {
+				break
+			}
+		}
+	}
+	return nil, errors.New("truncated age header")
+}
+
+// dearmor decodes the PEM-like ASCII armor age uses with -a.
+func dearmor(data []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(data))
+	text = strings.TrimPrefix(text, armorHeader)
+	end := strings.Index(text, armorFooter)
+	if end < 0 {
+		return nil, errors.New("armored age file has no end marker")
+	}
+	body := strings.Join(strings.Fields(text[:end]), "")
+	return base64.StdEncoding.DecodeString(body)
+}
+
+// sshTag computes the tag age puts in ssh-ed25519 and ssh-rsa stanzas: the
+// first four bytes of the SHA-256 of the SSH wire-format public key.
+func sshTag(key string) string {
+	fields := strings.Fields(key)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "ssh-") {
+		return ""
+	}
+	wire, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(wire)
+	return base64.RawStdEncoding.EncodeToString(sum[:4])
+}
+
+// identifyStanza names the recipient a stanza was made for, if the header
+// allows it. Only SSH stanzas carry a key tag that can be matched against
+// the recipients; X25519 stores just an ephemeral share.
+func identifyStanza(s stanza, recipients []recipient) (string, bool) {
+	switch s.Type {
+	case "scrypt":
+		return "passphrase", true
+	case "ssh-ed25519", "ssh-rsa":
+		if len(s.Args) == 0 {
+			return "", false
+		}
+		tag := s.Args[0]
+		for _, r := range recipients {
+			if sshTag(r.Key) == tag {
+				if r.Comment != "" {
+					return r.Comment, true
+				}
+				return truncateKey(r.Key), true
+			}
+		}
+		return fmt.Sprintf("unknown %s key (tag %s)", s.Type, tag), true
+	}
+	return "", false
+}
+
+// describeStanza explains who a stanza is for, using comments from the
+// recipients file where the stanza identifies its key.
+func describeStanza(s stanza, recipients []recipient) string {
+	if who, ok := identifyStanza(s, recipients); ok {
+		return who
+	}
+	switch s.Type {
+	case "X25519":
+		return "X25519 recipient (age headers do not record X25519 public keys)"
+	case "ssh-ed25519", "ssh-rsa":
+		return s.Type + " recipient"
+	}
+	return "plugin recipient " + s.Type
+}
+
+// truncateKey shortens a key for display.
+func truncateKey(key string) string {
+	if len(key) <= 24 {
+		return key
+	}
+	return key[:16] + "…" + key[len(key)-6:]
+}
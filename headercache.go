@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// status and stats read the header of every secret. The header cache keeps
+// the parsed stanzas of each, keyed by absolute path, so a run only parses
+// the files whose modification time or size changed since the last one.
+// Headers hold nothing secret, so unlike the get cache it is plain JSON.
+const headerCacheFile = "headers.json"
+
+// noCacheFlag is bound to --no-cache on status and stats.
+var noCacheFlag bool
+
+type headerEntry struct {
+	ModTime int64    `json:"mtime"`
+	Size    int64    `json:"size"`
+	Stanzas []stanza `json:"stanzas"`
+}
+
+type headerCache struct {
+	entries map[string]headerEntry
+	dirty   bool
+}
+
+// loadHeaderCache returns the header cache, empty if it is missing or
+// unreadable, or if --no-cache was given.
+func loadHeaderCache() *headerCache {
+	c := &headerCache{entries: map[string]headerEntry{}}
+	if noCacheFlag {
+		return c
+	}
+	data, err := ioutil.ReadFile(filepath.Join(cacheDir(), headerCacheFile))
+	if err != nil {
+		return c
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		printVerbose("Ignoring unreadable header cache: %v\n", err)
+		c.entries = map[string]headerEntry{}
+	}
+	return c
+}
+
+// readHeader is the package readHeader, answered from the cache when the
+// file is unchanged.
+func (c *headerCache) readHeader(path string) ([]stanza, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	key := path
+	if abs, err := filepath.Abs(path); err == nil {
+		key = abs
+	}
+	if e, ok := c.entries[key]; ok && e.ModTime == info.ModTime().UnixNano() && e.Size == info.Size() {
+		return e.Stanzas, nil
+	}
+	stanzas, err := readHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[key] = headerEntry{ModTime: info.ModTime().UnixNano(), Size: info.Size(), Stanzas: stanzas}
+	c.dirty = true
+	return stanzas, nil
+}
+
+// save writes the cache back if it changed, dropping the entries of files
+// that are gone. Failing to save only costs speed, so it is not an error.
+func (c *headerCache) save() {
+	if noCacheFlag {
+		return
+	}
+	for key := range c.entries {
+		if _, err := os.Stat(key); os.IsNotExist(err) {
+			delete(c.entries, key)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		return
+	}
+	dir, err := makeCacheDir()
+	if err != nil {
+		printVerbose("Not saving header cache: %v\n", err)
+		return
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return
+	}
+	file := filepath.Join(dir, headerCacheFile)
+	tmpPath := file + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		printVerbose("Not saving header cache: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmpPath, file); err != nil {
+		os.Remove(tmpPath)
+		printVerbose("Not saving header cache: %v\n", err)
+	}
+}
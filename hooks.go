@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var (
+	hookFlag   string
+	strictHook bool
+)
+
+// runHook runs the configured post-mutation hook, if any, with sh -c. The
+// operation and affected secret names are available to it as $1, $2... and
+// as SECRETS_OPERATION and SECRETS_NAMES (newline separated). Hook failures
+// only warn unless --strict-hook is set.
+func runHook(op string, names ...string) error {
+	// Every change ends up here, which makes it the place to log them
+	recordAudit(op, names...)
+
+	hook := cfg.PostHook
+	if hookFlag != "" {
+		hook = hookFlag
+	}
+	if hook == "" {
+		return nil
+	}
+
+	args := append([]string{"-c", hook, "secrets", op}, names...)
+	cmd := exec.Command("sh", args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"SECRETS_OPERATION="+op,
+		"SECRETS_NAMES="+strings.Join(names, "\n"),
+	)
+	if err := cmd.Run(); err != nil {
+		if strictHook {
+			return fmt.Errorf("post hook failed: %w", err)
+		}
+		printWarning("Warning: post hook failed: %v\n", err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// identityStdin is bound to --identity-stdin.
+var identityStdin bool
+
+// decryptWith is bound to the repeatable --decrypt-with.
+var decryptWith []string
+
+// decryptWithChain tries each --decrypt-with identity in turn on the age
+// file data, read from name, for stores in the middle of a migration where
+// secrets are readable by different keys.
+func decryptWithChain(data []byte, name string) (string, error) {
+	var lastErr error
+	for _, id := range decryptWith {
+		if _, err := os.Stat(expandHome(id)); err != nil {
+			return "", fmt.Errorf("reading identity: %w", err)
+		}
+		content, err := decryptDataWith(data, expandHome(id))
+		if err == nil {
+			printVerbose("Decrypted %s with %s\n", name, id)
+			return content, nil
+		}
+		if !errors.Is(err, ErrDecrypt) {
+			return "", err
+		}
+		printVerbose("%s cannot decrypt %s\n", id, name)
+		lastErr = err
+	}
+	return "", fmt.Errorf("none of the --decrypt-with identities can decrypt %s: %w", name, lastErr)
+}
+
+// selfRecipients derives the public keys of the identities this process
+// decrypts with. ok is false when none can be derived without asking for
+// anything: the identity file is missing, still passphrase-locked, or of a
+// kind whose public half isn't known. SSH private keys are matched through
+// the .pub file next to them.
+func selfRecipients() (keys []string, ok bool) {
+	if ids, inMemory, err := memoryIdentities(); inMemory {
+		if err != nil {
+			return nil, false
+		}
+		keys = x25519Recipients(ids)
+		return keys, len(keys) > 0
+	}
+	paths := decryptWith
+	if len(paths) == 0 {
+		paths = []string{keyPath}
+	}
+	for _, p := range paths {
+		keys = append(keys, fileRecipients(expandHome(p))...)
+	}
+	return keys, len(keys) > 0
+}
+
+// fileRecipients returns the public keys of the identity file at path that
+// can be derived without prompting.
+func fileRecipients(path string) []string {
+	if isEncryptedIdentity(path) {
+		return x25519Recipients(unlockedIdentities[path])
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	if ids, err := age.ParseIdentities(bytes.NewReader(data)); err == nil {
+		return x25519Recipients(ids)
+	}
+	if pub, err := os.ReadFile(path + ".pub"); err == nil {
+		return []string{strings.TrimSpace(string(pub))}
+	}
+	return nil
+}
+
+func x25519Recipients(ids []age.Identity) []string {
+	var keys []string
+	for _, id := range ids {
+		if x, ok := id.(*age.X25519Identity); ok {
+			keys = append(keys, x.Recipient().String())
+		}
+	}
+	return keys
+}
+
+// deriveRecipients returns the public keys of every identity in the file at
+// path. Encrypted identity files are unlocked with a passphrase. Where the
+// public half can't be computed, as for SSH and plugin identities, it is
+// read from the .pub file next to path or asked for on the terminal.
+func deriveRecipients(path string) ([]string, error) {
+	if isEncryptedIdentity(path) {
+		ids, err := unlockIdentity(path)
+		if err != nil {
+			return nil, err
+		}
+		return x25519Recipients(ids), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading identity: %w", err)
+	}
+	if ids, err := age.ParseIdentities(bytes.NewReader(data)); err == nil {
+		return x25519Recipients(ids), nil
+	}
+	if pub, err := os.ReadFile(path + ".pub"); err == nil {
+		var keys []string
+		for _, r := range parseRecipients(pub) {
+			keys = append(keys, r.Key)
+		}
+		return keys, nil
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot derive the public key of %s; put it in %s.pub", path, path)
+	}
+	defer tty.Close()
+	fmt.Fprintf(tty, "Public key for %s: ", path)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, fmt.Errorf("reading public key: %w", err)
+	}
+	key := strings.TrimSpace(line)
+	if err := validateRecipient(key); err != nil {
+		return nil, err
+	}
+	return []string{key}, nil
+}
+
+// maxIdentitySize bounds identity material read from stdin. The buffer is
+// allocated once at this size so that no partial copies are left behind by
+// growing it.
+const maxIdentitySize = 64 << 10
+
+var (
+	identityOnce     sync.Once
+	identityRead     bool
+	memIdentities    []age.Identity
+	memIdentitiesErr error
+)
+
+// memoryIdentities returns the identities given on stdin with
+// --identity-stdin or in $AGE_IDENTITY, for decrypting without an identity
+// file on disk. ok is false when neither is in use. Only X25519 identities
+// are supported.
+func memoryIdentities() (ids []age.Identity, ok bool, err error) {
+	if !identityStdin && os.Getenv("AGE_IDENTITY") == "" && !identityRead {
+		return nil, false, nil
+	}
+	identityOnce.Do(func() {
+		identityRead = true
+		var buf []byte
+		if identityStdin {
+			buf, memIdentitiesErr = readIdentity(os.Stdin)
+		} else {
+			buf = []byte(os.Getenv("AGE_IDENTITY"))
+			// Keep the key out of the editor, hooks and age itself
+			os.Unsetenv("AGE_IDENTITY")
+		}
+		defer clear(buf)
+		if memIdentitiesErr != nil {
+			return
+		}
+		memIdentities, memIdentitiesErr = age.ParseIdentities(bytes.NewReader(buf))
+		if memIdentitiesErr != nil {
+			memIdentitiesErr = fmt.Errorf("parsing identity: %w", memIdentitiesErr)
+		}
+	})
+	return memIdentities, true, memIdentitiesErr
+}
+
+func readIdentity(r io.Reader) ([]byte, error) {
+	buf := make([]byte, 0, maxIdentitySize)
+	for {
+		n, err := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			return buf, nil
+		}
+		if err != nil {
+			clear(buf)
+			return nil, fmt.Errorf("reading identity from stdin: %w", err)
+		}
+		if len(buf) == cap(buf) {
+			clear(buf)
+			return nil, errors.New("identity on stdin is too large")
+		}
+	}
+}
+
+// decryptNative decrypts the age file at path with the age library rather
+// than the age binary.
+func decryptNative(path string, ids []age.Identity) (string, error) {
+	data, err := readSecretFile(path)
+	if err != nil {
+		return "", err
+	}
+	return decryptNativeData(data, ids)
+}
+
+// decryptNativeData decrypts an age file held in memory, armored or not,
+// with the age library.
+func decryptNativeData(data []byte, ids []age.Identity) (string, error) {
+	var src io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armorHeader)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+	r, err := age.Decrypt(src, ids...)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	return string(out), nil
+}
+
+// unlockedIdentities holds passphrase-protected identity files once
+// decrypted, by path, so a command working on many secrets asks for the
+// passphrase only once.
+var unlockedIdentities = map[string][]age.Identity{}
+
+// isEncryptedIdentity reports whether the identity file at path is itself
+// age-encrypted with a passphrase, as age-keygen | age -p produces.
+func isEncryptedIdentity(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, len(armorHeader))
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	return bytes.HasPrefix(head, []byte(ageIntro)) || bytes.HasPrefix(head, []byte(armorHeader))
+}
+
+// unlockIdentity prompts for the passphrase of the encrypted identity file
+// at path and returns the identities inside it.
+func unlockIdentity(path string) ([]age.Identity, error) {
+	if ids, ok := unlockedIdentities[path]; ok {
+		return ids, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading identity: %w", err)
+	}
+
+	passphrase, err := readPassphrase(fmt.Sprintf("Passphrase for %s: ", path), false)
+	if err != nil {
+		return nil, fmt.Errorf("unlocking %s: %w", path, err)
+	}
+	scrypt, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var src io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armorHeader)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+	r, err := age.Decrypt(src, scrypt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unlocking %s: %v", ErrDecrypt, path, err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unlocking %s: %v", ErrDecrypt, path, err)
+	}
+	defer clear(plain)
+	ids, err := age.ParseIdentities(bytes.NewReader(plain))
+	if err != nil {
+		return nil, fmt.Errorf("parsing identity %s: %w", path, err)
+	}
+	unlockedIdentities[path] = ids
+	return ids, nil
+}
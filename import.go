@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import secrets from other tools",
+}
+
+var importSopsCmd = &cobra.Command{
+	Use:   "sops [file|dir]",
+	Short: "Import the values of SOPS-encrypted files as secrets",
+	Long: `Decrypt SOPS files with sops -d and store every leaf value as a secret.
+Nested keys are joined with --separator, so db: {password: x} in prod.yaml
+becomes db/password, or prod/db/password when a directory is imported.
+Files that fail to decrypt and secrets that already exist are skipped and
+reported; --force overwrites existing secrets.`,
+	Args: usageArgs(cobra.ExactArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		separator, _ := cmd.Flags().GetString("separator")
+		prefix, _ := cmd.Flags().GetString("prefix")
+		force, _ := cmd.Flags().GetBool("force")
+		if separator != "/" && separator != "." {
+			return fmt.Errorf("%w: --separator must be / or .", ErrUsage)
+		}
+		if _, err := exec.LookPath("sops"); err != nil {
+			return fmt.Errorf("sops not found in PATH: %w", err)
+		}
+		files, err := sopsFiles(args[0])
+		if err != nil {
+			return err
+		}
+		if !dryRun {
+			if err := requireMinRecipients(); err != nil {
+				return err
+			}
+		}
+
+		var res bulkResult
+		for _, f := range files {
+			values, err := sopsDecrypt(f.path)
+			if err != nil {
+				res.fail(f.path, err)
+				continue
+			}
+			base := strings.Trim(prefix, "/")
+			if f.name != "" {
+				base = strings.TrimPrefix(base+"/"+f.name, "/")
+			}
+			for _, leaf := range values {
+				key := strings.Join(leaf.keys, separator)
+				if base != "" {
+					key = base + "/" + key
+				}
+				secretName, secretPath, err := resolveSecret(key)
+				if err != nil {
+					res.fail(key, err)
+					continue
+				}
+				if _, err := os.Stat(secretPath); err == nil && !force {
+					printStatus("- %s: exists, skipped\n", displayName(secretName))
+					res.Skipped = append(res.Skipped, secretName)
+					continue
+				} else if os.IsNotExist(err) {
+					if err := checkNewName(secretName); err != nil {
+						res.fail(secretName, err)
+						continue
+					}
+				}
+				if dryRun {
+					printDryRun("write %s from %s:%s", displayName(secretName), f.path, strings.Join(leaf.keys, "."))
+					continue
+				}
+				if err := makeSecretDir(filepath.Dir(secretPath)); err != nil {
+					res.fail(secretName, fmt.Errorf("creating directory: %w", err))
+					continue
+				}
+				if err := encryptSecret(leaf.value, secretPath); err != nil {
+					res.fail(secretName, err)
+					continue
+				}
+				printStatus("✓ %s\n", displayName(secretName))
+				res.Processed = append(res.Processed, secretName)
+			}
+		}
+		for _, name := range res.Failed {
+			printWarning("✗ %s: %v\n", displayName(name), res.Errors[name])
+		}
+		if dryRun {
+			return nil
+		}
+		printStatus("✓ Imported %d secrets (%d skipped)\n", len(res.Processed), len(res.Skipped))
+		if len(res.Processed) > 0 {
+			if err := runHook("import", res.Processed...); err != nil {
+				return err
+			}
+		}
+		if len(res.Failed) > 0 {
+			return fmt.Errorf("%d entries could not be imported: %s", len(res.Failed), strings.Join(displayNames(res.Failed), ", "))
+		}
+		return nil
+	},
+}
+
+// sopsFile is a file to import and the name prefix its secrets get.
+type sopsFile struct {
+	path string
+	name string
+}
+
+// sopsFiles returns arg itself if it is a file, with no name prefix, or
+// every YAML, JSON and dotenv file under it if it is a directory, prefixed
+// by its path relative to arg without the extension.
+func sopsFiles(arg string) ([]sopsFile, error) {
+	info, err := os.Stat(arg)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []sopsFile{{path: arg}}, nil
+	}
+	var files []sopsFile
+	err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != arg && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch ext := filepath.Ext(path); ext {
+		case ".yaml", ".yml", ".json", ".env":
+			rel, _ := filepath.Rel(arg, path)
+			files = append(files, sopsFile{path: path, name: filepath.ToSlash(strings.TrimSuffix(rel, ext))})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", arg, err)
+	}
+	return files, nil
+}
+
+// sopsLeaf is one value of a decrypted file and the keys leading to it.
+type sopsLeaf struct {
+	keys  []string
+	value string
+}
+
+// sopsDecrypt runs sops -d on path and returns its leaf values, sorted by
+// key. Array elements are keyed by their index.
+func sopsDecrypt(path string) ([]sopsLeaf, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sops", "-d", "--output-type", "json", path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", ErrDecrypt, msg)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	dec := json.NewDecoder(&stdout)
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing sops output: %w", err)
+	}
+	var leaves []sopsLeaf
+	flattenSops(doc, nil, &leaves)
+	return leaves, nil
+}
+
+func flattenSops(v any, keys []string, leaves *[]sopsLeaf) {
+	switch v := v.(type) {
+	case map[string]any:
+		names := make([]string, 0, len(v))
+		for k := range v {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			flattenSops(v[k], append(keys[:len(keys):len(keys)], k), leaves)
+		}
+	case []any:
+		for i, e := range v {
+			flattenSops(e, append(keys[:len(keys):len(keys)], strconv.Itoa(i)), leaves)
+		}
+	case nil:
+	case string:
+		*leaves = append(*leaves, sopsLeaf{keys: keys, value: v})
+	default:
+		*leaves = append(*leaves, sopsLeaf{keys: keys, value: fmt.Sprint(v)})
+	}
+}
+
+func init() {
+	importSopsCmd.Flags().String("separator", "/", "join nested keys with / (namespaces) or . (dotted names)")
+	importSopsCmd.Flags().String("prefix", "", "namespace to import the secrets under")
+	importSopsCmd.Flags().BoolP("force", "f", false, "overwrite secrets that already exist")
+	importCmd.AddCommand(importSopsCmd)
+}
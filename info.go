@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var infoCmd = &cobra.Command{
+	Use:               "info [secret-name]",
+	Short:             "Show details about a secret without decrypting it",
+	Args:              usageArgs(cobra.ExactArgs(1)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		showRecipients, _ := cmd.Flags().GetBool("show-recipients")
+		showContent, _ := cmd.Flags().GetBool("content")
+
+		secretName, secretPath, err := resolveSecret(args[0])
+		if err != nil {
+			return err
+		}
+		stat, err := os.Stat(secretPath)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrSecretNotFound, displayName(secretName))
+		}
+		if err != nil {
+			return err
+		}
+		stanzas, err := readHeader(secretPath)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", displayName(secretName), err)
+		}
+
+		fmt.Printf("Name:        %s\n", displayName(secretName))
+		if meta, err := loadMeta(); err == nil && meta[secretName].Description != "" {
+			fmt.Printf("Description: %s\n", meta[secretName].Description)
+		}
+		fmt.Printf("Path:        %s\n", secretPath)
+		fmt.Printf("Size:        %d bytes\n", stat.Size())
+		fmt.Printf("Modified:    %s\n", stat.ModTime().Format(time.RFC3339))
+		if n := recipientStanzas(stanzas); n == 0 && len(stanzas) > 0 {
+			fmt.Println("Recipients:  passphrase")
+		} else {
+			fmt.Printf("Recipients:  %d\n", n)
+		}
+
+		if showContent {
+			content, err := decryptSecret(secretPath)
+			if err != nil {
+				return fmt.Errorf("decrypting secret: %w", err)
+			}
+			if isBinary(content) {
+				fmt.Println("Content:     binary (use get --binary; do not edit)")
+			} else {
+				fmt.Println("Content:     text")
+			}
+		}
+
+		if showRecipients {
+			if recorded, ok := loadSidecar(secretPath, stanzas); ok {
+				for _, r := range recorded {
+					fmt.Printf("  - %s\n", recipientName(r))
+				}
+				return nil
+			}
+			// Without recipients, stanzas just can't be named
+			recipients, _ := effectiveRecipients()
+			for _, s := range stanzas {
+				fmt.Printf("  - %s\n", describeStanza(s, recipients))
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	infoCmd.Flags().Bool("content", false, "decrypt to report whether the secret is text or binary")
+	infoCmd.Flags().Bool("show-recipients", false, "list who each recipient stanza is for, using recipients file comments")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseJSONPath splits a path such as ".client.keys[0].id" (the leading dot
+// is optional) into object keys and array indices.
+func parseJSONPath(path string) ([]string, error) {
+	var segments []string
+	rest := strings.TrimPrefix(path, ".")
+	for rest != "" {
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unclosed [ in JSON path %q", ErrUsage, path)
+			}
+			index := rest[1:end]
+			if _, err := strconv.Atoi(index); err != nil {
+				return nil, fmt.Errorf("%w: invalid array index %q in JSON path %q", ErrUsage, index, path)
+			}
+			segments = append(segments, rest[:end+1])
+			rest = strings.TrimPrefix(rest[end+1:], ".")
+			continue
+		}
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("%w: empty key in JSON path %q", ErrUsage, path)
+		}
+		segments = append(segments, rest[:end])
+		rest = strings.TrimPrefix(rest[end:], ".")
+	}
+	return segments, nil
+}
+
+// extractJSONPath returns the value at path in the JSON document content.
+// Strings are returned as is and anything else as JSON.
+func extractJSONPath(content, path string) (string, error) {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return "", err
+	}
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", fmt.Errorf("secret is not valid JSON: %w", err)
+	}
+	if v, err = walkPath(v, path, segments); err != nil {
+		return "", err
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return encodeJSON(v)
+}
+
+// walkPath follows segments, as parsed from path, into a decoded document.
+func walkPath(v interface{}, path string, segments []string) (interface{}, error) {
+	walked := ""
+	for _, seg := range segments {
+		if strings.HasPrefix(seg, "[") {
+			i, _ := strconv.Atoi(seg[1 : len(seg)-1])
+			arr, ok := v.([]interface{})
+			if !ok || i < 0 || i >= len(arr) {
+				return nil, fmt.Errorf("path %q not found at %s%s", path, walked, seg)
+			}
+			v = arr[i]
+		} else {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("path %q not found at %s.%s", path, walked, seg)
+			}
+			if v, ok = obj[seg]; !ok {
+				return nil, fmt.Errorf("path %q not found at %s.%s", path, walked, seg)
+			}
+			seg = "." + seg
+		}
+		walked += seg
+	}
+	return v, nil
+}
+
+func encodeJSON(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
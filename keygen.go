@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+)
+
+var keygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate a new age identity at the key path",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+		addSelf, _ := cmd.Flags().GetBool("add-self")
+		if addSelf && recipientsCommand() != "" {
+			return fmt.Errorf("%w: --add-self can't be used while recipients come from a command", ErrUsage)
+		}
+
+		path := identityPath()
+		if _, err := os.Stat(path); err == nil && !force {
+			return fmt.Errorf("%s already exists; pass --force to replace it", path)
+		}
+
+		identity, err := age.GenerateX25519Identity()
+		if err != nil {
+			return fmt.Errorf("generating identity: %w", err)
+		}
+		// Written beside the old key first so a failure can't lose it
+		tmpPath := path + ".tmp"
+		os.Remove(tmpPath)
+		if err := writeIdentity(tmpPath, identity); err != nil {
+			return err
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("writing identity: %w", err)
+		}
+		printStatus("✓ Wrote new identity to %s\n", path)
+
+		recipient := identity.Recipient().String()
+		if addSelf {
+			if onlyPlaceholder() {
+				if err := replacePlaceholder(recipient); err != nil {
+					return err
+				}
+			} else if _, err := appendRecipient(recipient, ""); err != nil {
+				return err
+			}
+			printStatus("✓ Added it to %s\n", recipientsFile)
+		}
+		// The public key is the useful output, so it is printed even with --quiet
+		fmt.Println(recipient)
+		return nil
+	},
+}
+
+func init() {
+	keygenCmd.Flags().Bool("force", false, "replace an existing identity")
+	keygenCmd.Flags().Bool("add-self", false, "also add the new public key to the recipients file")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List secret names",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		print0, _ := cmd.Flags().GetBool("print0")
+		long, _ := cmd.Flags().GetBool("long")
+		if long && print0 {
+			return fmt.Errorf("%w: --long and --print0 cannot be combined", ErrUsage)
+		}
+		sortBy, _ := cmd.Flags().GetString("sort")
+		if sortBy != "name" && sortBy != "size" && sortBy != "time" {
+			return fmt.Errorf("%w: --sort must be name, size or time", ErrUsage)
+		}
+		if long || sortBy != "name" {
+			rawBytes, _ := cmd.Flags().GetBool("bytes")
+			return listSecrets(sortBy, rawBytes, long)
+		}
+
+		// NUL can't occur in a file name, so -0 is safe for xargs -0
+		sep := "\n"
+		if print0 {
+			sep = "\x00"
+		}
+		for _, name := range getSecretNames() {
+			fmt.Print(displayName(name) + sep)
+		}
+		return nil
+	},
+}
+
+// listedSecret is a secret with the file details list sorts on.
+type listedSecret struct {
+	name     string
+	size     int64
+	modified time.Time
+}
+
+// listSecrets prints the secrets ordered by sortBy: name, size (largest first)
+// or time (newest first). With long set, each line has the size,
+// modification time and description too; sizes are humanized unless
+// rawBytes is set.
+func listSecrets(sortBy string, rawBytes, long bool) error {
+	meta, err := loadMeta()
+	if err != nil {
+		return err
+	}
+	var secrets []listedSecret
+	for _, name := range getSecretNames() {
+		info, err := os.Stat(filepath.Join(secretsDir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		secrets = append(secrets, listedSecret{name, info.Size(), info.ModTime()})
+	}
+	sort.SliceStable(secrets, func(i, j int) bool {
+		switch sortBy {
+		case "size":
+			return secrets[i].size > secrets[j].size
+		case "time":
+			return secrets[i].modified.After(secrets[j].modified)
+		}
+		return secrets[i].name < secrets[j].name
+	})
+	if !long {
+		for _, s := range secrets {
+			fmt.Println(displayName(s.name))
+		}
+		return nil
+	}
+
+	sizes := make([]string, len(secrets))
+	nameWidth, sizeWidth := 0, 0
+	for i, s := range secrets {
+		if rawBytes {
+			sizes[i] = strconv.FormatInt(s.size, 10)
+		} else {
+			sizes[i] = humanSize(s.size)
+		}
+		nameWidth = max(nameWidth, len(displayName(s.name)))
+		sizeWidth = max(sizeWidth, len(sizes[i]))
+	}
+	for i, s := range secrets {
+		line := fmt.Sprintf("%*s  %s  %s", sizeWidth, sizes[i], s.modified.Format("2006-01-02 15:04"), displayName(s.name))
+		if d := meta[s.name].Description; d != "" {
+			line = fmt.Sprintf("%s%*s  %s", line, nameWidth-len(displayName(s.name)), "", d)
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// humanSize formats a byte count with binary units, e.g. 1.5 KiB.
+func humanSize(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	for _, unit := range []string{"KiB", "MiB", "GiB"} {
+		value /= 1024
+		if value < 1024 || unit == "GiB" {
+			return fmt.Sprintf("%.1f %s", value, unit)
+		}
+	}
+	return ""
+}
+
+func init() {
+	listCmd.Flags().BoolP("long", "l", false, "show each secret's size, modification time and description")
+	listCmd.Flags().Bool("bytes", false, "with --long, print sizes as exact byte counts")
+	listCmd.Flags().String("sort", "name", "order by name, size (largest first) or time (newest first)")
+	listCmd.Flags().BoolP("print0", "0", false, "separate names with NUL instead of newline, for xargs -0")
+}
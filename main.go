@@ -3,190 +3,1418 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
-const (
-	secretsDir     = "secrets"
-	recipientsFile = ".age-recipients"
-	defaultKeyPath = "~/.config/age/keys.txt"
+const defaultKeyPath = "~/.config/age/keys.txt"
+
+// Store locations, overridable with --dir, --recipients and --key.
+// recipientsFile is the first of recipientsFiles, the one commands that add
+// recipients write to.
+var (
+	secretsDir      = "secrets"
+	recipientsFile  = ".age-recipients"
+	recipientsFiles = []string{recipientsFile}
+	keyPath         = defaultKeyPath
+)
+
+var (
+	quiet   bool
+	verbose bool
+	dryRun  bool
 )
 
 var rootCmd = &cobra.Command{
-	Use:   "secrets",
-	Short: "Manage age-encrypted secrets",
+	Use:           "secrets",
+	Short:         "Manage age-encrypted secrets",
+	Args:          usageArgs(cobra.NoArgs),
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		cfg, err = loadConfig()
+		if err != nil {
+			return err
+		}
+		if !cmd.Flags().Changed("recipients") && len(cfg.RecipientsFiles) > 0 {
+			recipientsFiles = cfg.RecipientsFiles
+		}
+		if err := applyProfile(cmd); err != nil {
+			return err
+		}
+		recipientsFile = recipientsFiles[0]
+		if modeFlag != "" {
+			if cfg.SecretMode, err = parseFileMode(modeFlag); err != nil {
+				return fmt.Errorf("%w: --mode: %v", ErrUsage, err)
+			}
+			if err := checkOwnerMode(cfg.SecretMode, 0600); err != nil {
+				return fmt.Errorf("%w: --mode: %v", ErrUsage, err)
+			}
+		}
+		if ageBinaryFlag != "" || os.Getenv("AGE_BINARY") != "" {
+			// An explicit override that doesn't resolve is a configuration
+			// mistake worth failing on before doing any work
+			if _, err := agePath(); err != nil {
+				return err
+			}
+		}
+		if verbose {
+			// Only for the log line; commands re-check when they need age
+			detectAge()
+		}
+		return nil
+	},
+	// Runnable so that unknown subcommands surface as usage errors
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
 }
 
 var generateCmd = &cobra.Command{
 	Use:   "generate",
 	Short: "Initialize secrets directory and recipients file",
-	Run: func(cmd *cobra.Command, args []string) {
-		if err := os.MkdirAll(secretsDir, 0755); err != nil {
-			fmt.Printf("Error creating directory: %v\n", err)
-			os.Exit(1)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := makeSecretDir(secretsDir); err != nil {
+			return fmt.Errorf("creating directory: %w", err)
 		}
 
 		if _, err := os.Stat(recipientsFile); os.IsNotExist(err) {
-			content := "# Add age public keys, one per line\nage1k0sc4ugaxzpav2rs8cmugwthaa3tpuzygvax8u84m6sm9ldh737qspv058\n"
+			content := "# Add age public keys, one per line\n\n" + placeholderRecipient + "\n"
 			if err := ioutil.WriteFile(recipientsFile, []byte(content), 0644); err != nil {
-				fmt.Printf("Error creating recipients file: %v\n", err)
-				os.Exit(1)
+				return fmt.Errorf("creating recipients file: %w", err)
 			}
-			fmt.Println("✓ Created recipients file")
+			printStatus("✓ Created recipients file\n")
 		}
-		fmt.Println("✓ Secrets directory ready")
+		printStatus("✓ Secrets directory ready\n")
+		return nil
 	},
 }
 
 var addCmd = &cobra.Command{
 	Use:   "add [secret-name]",
 	Short: "Add a new secret",
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		secretName := args[0]
-		if !strings.HasSuffix(secretName, ".age") {
-			secretName += ".age"
+	Args:  usageArgs(cobra.ExactArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		secretName, secretPath, err := resolveSecret(args[0])
+		if err != nil {
+			return err
+		}
+		_, statErr := os.Stat(secretPath)
+		if os.IsNotExist(statErr) {
+			if err := checkNewName(secretName); err != nil {
+				return err
+			}
+		}
+		if dryRun {
+			action := "create"
+			if statErr == nil {
+				action = "overwrite"
+			}
+			printDryRun("%s %s", action, secretPath)
+			return nil
+		}
+		// Passphrase secrets have no use for recipients
+		usePassphrase, _ := cmd.Flags().GetBool("passphrase")
+		var passphrase string
+		if usePassphrase {
+			if passphrase, err = readPassphrase("Passphrase: ", true); err != nil {
+				return err
+			}
+		} else {
+			if err := firstRunWizard(cmd); err != nil {
+				return err
+			}
+			// Fail before asking for a value that couldn't be stored
+			if err := requireMinRecipients(); err != nil {
+				return err
+			}
+			if err := confirmRecipients(); err != nil {
+				return err
+			}
 		}
 
-		fmt.Print("Enter secret value: ")
-		scanner := bufio.NewScanner(os.Stdin)
-		scanner.Scan()
-		value := scanner.Text()
+		binary, _ := cmd.Flags().GetBool("binary")
+		fromFile, _ := cmd.Flags().GetString("from-file")
+
+		var value string
+		switch {
+		case fromFile != "":
+			data, err := ioutil.ReadFile(fromFile)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", fromFile, err)
+			}
+			value = string(data)
+		case binary:
+			// Raw bytes, untouched by line handling
+			data, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("reading stdin: %w", err)
+			}
+			value = string(data)
+		default:
+			prompt, _ := cmd.Flags().GetString("prompt")
+			multiline, _ := cmd.Flags().GetBool("multiline")
+			if value, err = readValue(os.Stdin, os.Stderr, prompt, multiline); err != nil {
+				return err
+			}
+		}
 
-		secretPath := filepath.Join(secretsDir, secretName)
-		if err := encryptSecret(value, secretPath); err != nil {
-			fmt.Printf("Error encrypting secret: %v\n", err)
-			os.Exit(1)
+		if err := makeSecretDir(filepath.Dir(secretPath)); err != nil {
+			return fmt.Errorf("creating directory: %w", err)
+		}
+		if usePassphrase {
+			err = encryptWithPassphrase(value, secretPath, passphrase)
+		} else {
+			err = encryptSecret(value, secretPath)
 		}
-		fmt.Printf("✓ Secret '%s' encrypted\n", secretName)
+		if err != nil {
+			return fmt.Errorf("encrypting secret: %w", err)
+		}
+		if description, _ := cmd.Flags().GetString("description"); description != "" {
+			if err := setDescription(secretName, description); err != nil {
+				return err
+			}
+		}
+		printStatus("✓ Secret '%s' encrypted\n", displayName(secretName))
+		if checkDrift, _ := cmd.Flags().GetBool("check-drift"); (checkDrift || cfg.RekeyOnAdd) && !usePassphrase {
+			warnDrift(secretName)
+		}
+		return runHook("add", secretName)
 	},
 }
 
 var editCmd = &cobra.Command{
 	Use:   "edit [secret-name]",
 	Short: "Edit an existing secret",
-	Args:  cobra.ExactArgs(1),
-	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return getSecretNames(), cobra.ShellCompDirectiveNoFileComp
-	},
-	Run: func(cmd *cobra.Command, args []string) {
-		secretName := args[0]
-		if !strings.HasSuffix(secretName, ".age") {
-			secretName += ".age"
+	Long: `Decrypt a secret into a temporary file, open it in $EDITOR (vim by default)
+and encrypt what was saved. $EDITOR may hold arguments, quoted as in a
+shell, e.g. "code --wait"; code, subl and other GUI editors get their wait
+flag added if it is missing. Leaving the editor without saving changes
+nothing and exits with an error.`,
+	Args:              usageArgs(cobra.ExactArgs(1)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		secretName, secretPath, err := resolveSecret(args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(secretPath); os.IsNotExist(err) {
+			// Catch typos in the name rather than quietly starting a new secret
+			if create, _ := cmd.Flags().GetBool("create"); !create {
+				return fmt.Errorf("%w: %s; pass --create to make a new one", ErrSecretNotFound, displayName(secretName))
+			}
+		}
+		if !dryRun && !isPassphraseSecret(secretPath) {
+			// The wizard writes files of its own
+			if err := firstRunWizard(cmd); err != nil {
+				return err
+			}
+			if err := requireMinRecipients(); err != nil {
+				return err
+			}
+			if err := confirmRecipients(); err != nil {
+				return err
+			}
 		}
 
-		secretPath := filepath.Join(secretsDir, secretName)
+		// Create temp file, named after the secret so that one left behind
+		// can be told apart
+		tempFile, err := ioutil.TempFile("", "secret-"+tempName(secretName)+"-*.txt")
+		if err != nil {
+			return fmt.Errorf("creating temp file: %w", err)
+		}
+		keepTemp := false
+		defer func() {
+			if !keepTemp {
+				os.Remove(tempFile.Name())
+			}
+		}()
 
-		// Create temp file
-		tempFile, err := ioutil.TempFile("", "secret-*.txt")
+		// Remember what was on disk, to notice a sync or another edit
+		// overwriting it while the editor is open
+		before, err := fileDigest(secretPath)
 		if err != nil {
-			fmt.Printf("Error creating temp file: %v\n", err)
-			os.Exit(1)
+			return err
 		}
-		defer os.Remove(tempFile.Name())
 
 		// Decrypt existing content if file exists
-		if _, err := os.Stat(secretPath); err == nil {
+		var original string
+		_, statErr := os.Stat(secretPath)
+		if statErr == nil {
 			content, err := decryptSecret(secretPath)
 			if err != nil {
-				fmt.Printf("Error decrypting secret: %v\n", err)
-				os.Exit(1)
+				return fmt.Errorf("decrypting secret: %w", err)
+			}
+			if force, _ := cmd.Flags().GetBool("force"); isBinary(content) && !force {
+				return fmt.Errorf("%s holds binary data that an editor would corrupt; replace it with add --binary, or pass --force", displayName(secretName))
 			}
 			tempFile.WriteString(content)
+			original = content
 		}
 		tempFile.Close()
+		opened, err := os.Stat(tempFile.Name())
+		if err != nil {
+			return err
+		}
 
 		// Open editor
-		editor := os.Getenv("EDITOR")
-		if editor == "" {
-			editor = "vim"
+		editor, err := editorCommand()
+		if err != nil {
+			return err
 		}
-
-		editCmd := exec.Command(editor, tempFile.Name())
+		editCmd := exec.Command(editor[0], append(editor[1:], tempFile.Name())...)
 		editCmd.Stdin = os.Stdin
 		editCmd.Stdout = os.Stdout
 		editCmd.Stderr = os.Stderr
 
 		if err := editCmd.Run(); err != nil {
-			fmt.Printf("Error running editor: %v\n", err)
-			os.Exit(1)
+			// The editor may have saved work before failing
+			keepTemp = true
+			return fmt.Errorf("running editor: %w; the file it edited is kept at %s", err, tempFile.Name())
+		}
+		// An editor that returns at once would have the old value written
+		// back before anything was typed
+		if saved, err := os.Stat(tempFile.Name()); err == nil && saved.ModTime().Equal(opened.ModTime()) {
+			return errors.New("the editor exited without saving, so nothing was changed; if it returns before you close the file, add its wait flag to $EDITOR, e.g. \"code --wait\"")
 		}
 
 		// Read edited content
 		content, err := ioutil.ReadFile(tempFile.Name())
 		if err != nil {
-			fmt.Printf("Error reading temp file: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("reading temp file: %w", err)
+		}
+
+		if dryRun {
+			switch {
+			case statErr != nil:
+				printDryRun("create %s (edits discarded)", secretPath)
+			case string(content) == original:
+				printDryRun("leave %s unchanged", secretPath)
+			default:
+				printDryRun("overwrite %s (edits discarded)", secretPath)
+			}
+			return nil
+		}
+
+		if err := checkUnchanged(secretPath, before, original); err != nil {
+			saved, saveErr := keepEdits(content)
+			if saveErr != nil {
+				return fmt.Errorf("%w; saving your edits also failed: %v", err, saveErr)
+			}
+			return fmt.Errorf("%w; your edits are in %s", err, saved)
 		}
 
 		// Encrypt and save
-		if err := encryptSecret(string(content), secretPath); err != nil {
-			fmt.Printf("Error encrypting secret: %v\n", err)
-			os.Exit(1)
+		if err := makeSecretDir(filepath.Dir(secretPath)); err != nil {
+			return fmt.Errorf("creating directory: %w", err)
+		}
+		// A passphrase secret stays one, under the passphrase it was opened with
+		if passphrase, ok := secretPassphrases[secretPath]; ok {
+			err = encryptWithPassphrase(string(content), secretPath, passphrase)
+		} else {
+			err = encryptSecret(string(content), secretPath)
 		}
-		fmt.Printf("✓ Secret '%s' updated\n", secretName)
+		if err != nil {
+			return fmt.Errorf("encrypting secret: %w", err)
+		}
+		printStatus("✓ Secret '%s' updated\n", displayName(secretName))
+		return runHook("edit", secretName)
 	},
 }
 
+// tempName reduces a secret name to letters, digits and dashes, short
+// enough to go in a temp file name.
+func tempName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.TrimSuffix(name, ".age"))
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return strings.Trim(name, "-")
+}
+
+// waitFlags are the flags that make GUI editors wait for the file to be
+// closed, rather than hand it to a running instance and exit.
+var waitFlags = map[string]string{
+	"code":          "--wait",
+	"code-insiders": "--wait",
+	"codium":        "--wait",
+	"subl":          "--wait",
+	"atom":          "--wait",
+	"zed":           "--wait",
+	"mate":          "-w",
+	"gvim":          "-f",
+	"mvim":          "-f",
+}
+
+// editorCommand splits $EDITOR, vim if unset, into a program and its
+// arguments, adding the wait flag of a known GUI editor that lacks one.
+func editorCommand() ([]string, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vim"
+	}
+	words, err := splitCommand(editor)
+	if err != nil {
+		return nil, fmt.Errorf("parsing $EDITOR: %w", err)
+	}
+	if len(words) == 0 {
+		return []string{"vim"}, nil
+	}
+	if flag, ok := waitFlags[filepath.Base(words[0])]; ok {
+		has := false
+		for _, w := range words[1:] {
+			if w == flag || (flag == "--wait" && w == "-w") || (flag == "-f" && w == "--nofork") {
+				has = true
+			}
+		}
+		if !has {
+			words = append(words, flag)
+		}
+	}
+	return words, nil
+}
+
+// splitCommand splits s into words at spaces and tabs as a shell would,
+// honouring single and double quotes and backslash escapes, but nothing
+// else.
+func splitCommand(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// readValue writes prompt to w, stderr in add so that stdout carries only
+// output, and reads one line from r without its line ending. When r is a
+// terminal, the input is not echoed. With multiline, everything up to EOF
+// is read and kept as it is, echoed on a terminal since it can't be read
+// blind.
+func readValue(r io.Reader, w io.Writer, prompt string, multiline bool) (string, error) {
+	fmt.Fprint(w, prompt)
+	if multiline {
+		if f, ok := r.(*os.File); ok && isTerminal(f) {
+			fmt.Fprintln(w, "(end with Ctrl-D on a line of its own)")
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return "", fmt.Errorf("reading value: %w", err)
+		}
+		return string(data), nil
+	}
+	if f, ok := r.(*os.File); ok && isTerminal(f) {
+		b, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(w)
+		if err != nil {
+			return "", fmt.Errorf("reading value: %w", err)
+		}
+		return string(b), nil
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Scan()
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("reading value: %w", err)
+	}
+	return scanner.Text(), nil
+}
+
+// fileDigest returns the SHA-256 of the file at path, or "" if there is none.
+func fileDigest(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// checkUnchanged fails if the secret at path no longer has the digest it had
+// when editing started. A file that was only re-encrypted, say by rekey,
+// still holds original and doesn't count as changed.
+func checkUnchanged(path, digest, original string) error {
+	now, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+	if now == digest {
+		return nil
+	}
+	if now != "" && digest != "" {
+		if content, err := decryptSecret(path); err == nil && content == original {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s changed on disk while it was being edited", path)
+}
+
+// keepEdits saves edited content that could not be written back to a
+// private temp file and returns its path.
+func keepEdits(content []byte) (string, error) {
+	f, err := ioutil.TempFile("", "secret-edit-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(content); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
 var getCmd = &cobra.Command{
-	Use:   "get [secret-name]",
-	Short: "Get a secret value",
-	Args:  cobra.ExactArgs(1),
-	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return getSecretNames(), cobra.ShellCompDirectiveNoFileComp
+	Use:               "get [secret-name]",
+	Short:             "Get a secret value",
+	Args:              usageArgs(cobra.ExactArgs(1)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		backend, name, err := backendFor(args[0])
+		if err != nil {
+			return err
+		}
+		if prefix, _ := cmd.Flags().GetBool("prefix"); prefix {
+			if _, ok := backend.(ageBackend); ok {
+				if name, err = resolvePrefix(name); err != nil {
+					return err
+				}
+			}
+		}
+
+		line, _ := cmd.Flags().GetInt("line")
+		lines, _ := cmd.Flags().GetString("lines")
+		byteRange, _ := cmd.Flags().GetString("bytes")
+		sel, err := parseSelection(line, lines, byteRange)
+		if err != nil {
+			return err
+		}
+		// --raw is another name for --binary
+		binary, _ := cmd.Flags().GetBool("binary")
+		if raw, _ := cmd.Flags().GetBool("raw"); raw {
+			binary = true
+		}
+		if binary && sel.byLine {
+			return fmt.Errorf("%w: --line and --lines do not apply to --binary output", ErrUsage)
+		}
+		// --jsonpath, --yaml-key and --toml-key pick a field out of a
+		// structured secret
+		var fieldFlag, fieldPath string
+		var extract func(content, path string) (string, error)
+		for _, f := range []struct {
+			flag    string
+			extract func(content, path string) (string, error)
+		}{{"jsonpath", extractJSONPath}, {"yaml-key", extractYAMLKey}, {"toml-key", extractTOMLKey}} {
+			p, _ := cmd.Flags().GetString(f.flag)
+			if p == "" {
+				continue
+			}
+			if fieldFlag != "" {
+				return fmt.Errorf("%w: --%s and --%s cannot be combined", ErrUsage, fieldFlag, f.flag)
+			}
+			fieldFlag, fieldPath, extract = f.flag, p, f.extract
+		}
+		if fieldFlag != "" {
+			if binary || sel.byLine || sel.byByte {
+				return fmt.Errorf("%w: --%s cannot be combined with --binary, --line, --lines or --bytes", ErrUsage, fieldFlag)
+			}
+			if _, err := parseJSONPath(fieldPath); err != nil {
+				return err
+			}
+		}
+
+		if _, ok := backend.(ageBackend); ok {
+			confirmed, _ := cmd.Flags().GetBool("confirm")
+			if err := confirmReveal(name, confirmed); err != nil {
+				return err
+			}
+		}
+
+		// Only age files have a modification time to check staleness and
+		// validate cache entries against
+		_, isAge := backend.(ageBackend)
+		secretName, secretPath := name, ""
+		if isAge {
+			if secretName, secretPath, err = resolveSecret(name); err != nil {
+				return err
+			}
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		fifo, _ := cmd.Flags().GetBool("fifo")
+		fifoTimeout, _ := cmd.Flags().GetDuration("fifo-timeout")
+		if fifo && output != "" {
+			return fmt.Errorf("%w: --fifo and --output cannot be combined", ErrUsage)
+		}
+		emit := func(content string) error {
+			if fifo {
+				return writeFifo(content, fifoTimeout)
+			}
+			if output == "" {
+				_, err := os.Stdout.Write([]byte(content))
+				return err
+			}
+			if looksEncrypted(content) {
+				printWarning("Warning: the decrypted value is itself an age file; the secret may be encrypted twice\n")
+			}
+			return writeRendered([]renderedFile{{path: output, data: []byte(content)}})
+		}
+		format, _ := cmd.Flags().GetString("format")
+		withMeta, _ := cmd.Flags().GetBool("with-metadata")
+		switch {
+		case format != "text" && format != "json":
+			return fmt.Errorf("%w: --format must be text or json", ErrUsage)
+		case withMeta && format != "json":
+			return fmt.Errorf("%w: --with-metadata needs --format json", ErrUsage)
+		case withMeta && !isAge:
+			return fmt.Errorf("%w: --with-metadata only applies to age secrets", ErrUsage)
+		}
+		if format == "json" {
+			if binary {
+				return fmt.Errorf("%w: --format json cannot be combined with --binary", ErrUsage)
+			}
+			write := emit
+			emit = func(content string) error {
+				out, err := secretJSON(secretName, secretPath, content, withMeta)
+				if err != nil {
+					return err
+				}
+				return write(out)
+			}
+		}
+		ttl, _ := cmd.Flags().GetDuration("cache-ttl")
+		useCache := ttl > 0 && isAge
+
+		var data []byte
+		value, ok := "", false
+		if useCache {
+			value, ok = cachedSecret(secretPath)
+			data = []byte(value)
+		}
+		if !ok {
+			data, err = backend.Get(name)
+			if errors.Is(err, ErrSecretNotFound) && cmd.Flags().Changed("default") {
+				fallback, _ := cmd.Flags().GetString("default")
+				return emit(fallback)
+			}
+			if err != nil {
+				return err
+			}
+			value = string(data)
+			if useCache {
+				if err := cacheSecret(secretPath, value, ttl); err != nil {
+					printVerbose("Not caching %s: %v\n", name, err)
+				}
+			}
+		}
+		if isAge {
+			recordAudit("get", secretName)
+			warnIfStale(secretPath)
+		}
+		if extract != nil {
+			field, err := extract(value, fieldPath)
+			if err != nil {
+				return err
+			}
+			return emit(field + "\n")
+		}
+		if binary && !sel.byByte && output == "" && !fifo {
+			// The decrypted bytes as the backend returned them, nothing
+			// added
+			_, err := os.Stdout.Write(data)
+			return err
+		}
+		content, err := sel.apply(value)
+		if err != nil {
+			return err
+		}
+		return emit(content)
+	},
+}
+
+var existsCmd = &cobra.Command{
+	Use:   "exists [secret-name]",
+	Short: "Exit 0 if a secret exists and 1 if not, without decrypting it",
+	Long: `Check whether a secret exists by looking for its file. Nothing is
+decrypted, so no key is needed and nothing prompts. Nothing is printed
+either; the exit code is the answer.`,
+	Args:              usageArgs(cobra.ExactArgs(1)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		secretName, secretPath, err := resolveSecret(args[0])
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(secretPath); err != nil || info.IsDir() {
+			printVerbose("%s does not exist\n", displayName(secretName))
+			return errAbsent
+		}
+		printVerbose("%s exists\n", displayName(secretName))
+		return nil
 	},
-	Run: func(cmd *cobra.Command, args []string) {
-		secretName := args[0]
-		if !strings.HasSuffix(secretName, ".age") {
-			secretName += ".age"
+}
+
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt [path]",
+	Short: "Decrypt any age file with the identity, e.g. one sent to you",
+	Long: `Decrypt an age file anywhere on disk, armored or not, with the same
+identities as get: --key, every --decrypt-with in turn, or the passphrase a
+passphrase-encrypted file asks for. The plaintext goes to stdout, or to
+--output with 0600 permissions. The file need not be in the store, and
+the store is not changed.`,
+	Args: usageArgs(cobra.ExactArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+		path := args[0]
+		if info, err := os.Stat(path); err != nil {
+			return err
+		} else if info.IsDir() {
+			return fmt.Errorf("%w: %s is a directory", ErrUsage, path)
+		}
+		content, err := decryptSecret(path)
+		if err != nil {
+			return fmt.Errorf("decrypting %s: %w", path, err)
+		}
+		if output != "" {
+			return writeRendered([]renderedFile{{path: output, data: []byte(content)}})
+		}
+		_, err = os.Stdout.Write([]byte(content))
+		return err
+	},
+}
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt [path]",
+	Short: "Encrypt any file to the recipients, without storing it",
+	Long: `Encrypt a file to the current recipients, or to the --recipient keys
+only, writing the age file to stdout or --output, e.g. to send it to a
+teammate whose key is in the recipients file:
+
+  secrets encrypt notes.txt --armor | mail ...
+
+The file does not become a secret, and the store is not changed.`,
+	Args: usageArgs(cobra.ExactArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys, _ := cmd.Flags().GetStringArray("recipient")
+		armor, _ := cmd.Flags().GetBool("armor")
+		output, _ := cmd.Flags().GetString("output")
+		for _, key := range keys {
+			if err := validateRecipient(key); err != nil {
+				return err
+			}
+		}
+		if len(keys) == 0 {
+			recipients, err := effectiveRecipients()
+			if err != nil {
+				return err
+			}
+			if err := checkRecipientFeatures(recipients); err != nil {
+				return err
+			}
+			for _, r := range recipients {
+				keys = append(keys, r.Key)
+			}
+			if len(keys) == 0 {
+				return fmt.Errorf("%w: there are no recipients; pass --recipient", ErrUsage)
+			}
+		}
+		if output == "" && !armor && isTerminal(os.Stdout) {
+			return fmt.Errorf("%w: refusing to write binary ciphertext to a terminal; pass --armor or redirect it", ErrUsage)
 		}
 
-		secretPath := filepath.Join(secretsDir, secretName)
-		content, err := decryptSecret(secretPath)
+		data, err := os.ReadFile(args[0])
 		if err != nil {
-			fmt.Printf("Error decrypting secret: %v\n", err)
-			os.Exit(1)
+			return err
+		}
+		var buf bytes.Buffer
+		if err := encryptFor(&buf, string(data), keys, armor); err != nil {
+			return fmt.Errorf("encrypting %s: %w", args[0], err)
 		}
-		fmt.Print(content)
+		if output != "" {
+			return writeRendered([]renderedFile{{path: output, data: buf.Bytes()}})
+		}
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
 	},
 }
 
+// getResult is the output of get --format json.
+type getResult struct {
+	Name           string     `json:"name"`
+	Value          string     `json:"value"`
+	Mtime          *time.Time `json:"mtime,omitempty"`
+	Size           *int64     `json:"size,omitempty"`
+	RecipientCount *int       `json:"recipient_count,omitempty"`
+	Description    string     `json:"description,omitempty"`
+	Expires        *time.Time `json:"expires,omitempty"`
+}
+
+// secretJSON encodes value as get --format json prints it. withMeta adds
+// what info reports about the file at path, which needs no second decrypt.
+// There is no expiry as such; expires is when warn_after makes it stale.
+func secretJSON(name, path, value string, withMeta bool) (string, error) {
+	if isBinary(value) {
+		return "", fmt.Errorf("%w: %s holds binary data, which JSON cannot carry; use --binary", ErrUsage, displayName(name))
+	}
+	res := getResult{Name: displayName(name), Value: value}
+	// A --default value has no file to describe
+	if stat, err := os.Stat(path); withMeta && err == nil {
+		stanzas, err := readHeader(path)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", displayName(name), err)
+		}
+		mtime, size, count := stat.ModTime(), stat.Size(), recipientStanzas(stanzas)
+		res.Mtime, res.Size, res.RecipientCount = &mtime, &size, &count
+		if meta, err := loadMeta(); err == nil {
+			res.Description = meta[name].Description
+		}
+		if cfg.WarnAfter > 0 {
+			expires := mtime.Add(time.Duration(cfg.WarnAfter))
+			res.Expires = &expires
+		}
+	}
+	out, err := encodeJSON(res)
+	return out + "\n", err
+}
+
+// printStatus writes a human-readable progress message unless --quiet is set.
+func printStatus(format string, a ...interface{}) {
+	if !quiet {
+		fmt.Printf(format, a...)
+	}
+}
+
+// printDryRun describes a change --dry-run kept from happening. It is the
+// point of a dry run, so --quiet does not silence it.
+func printDryRun(format string, a ...interface{}) {
+	fmt.Printf("Would "+format+"\n", a...)
+}
+
+// confirm asks a yes/no question on the terminal and defaults to no.
+func confirm(prompt string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", prompt)
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return answer == "y" || answer == "yes"
+}
+
+// printVerbose writes a diagnostic message to stderr when --verbose is set.
+func printVerbose(format string, a ...interface{}) {
+	if verbose && !quiet {
+		fmt.Fprintf(os.Stderr, format, a...)
+	}
+}
+
+// printWarning writes a message to stderr unless --quiet is set.
+func printWarning(format string, a ...interface{}) {
+	if !quiet {
+		fmt.Fprintf(os.Stderr, format, a...)
+	}
+}
+
+// ageError converts a failed age invocation into an error that carries the
+// matching sentinel and age's own diagnostic output.
+func ageError(err error, stderr []byte, kind error) error {
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("%w: %v", ErrAgeNotFound, err)
+	}
+	if errors.Is(err, ErrAgeNotFound) {
+		return err
+	}
+	// Only an age that ran and refused tells us anything about the crypto
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return fmt.Errorf("running age: %w", err)
+	}
+	if msg := strings.TrimSpace(string(stderr)); msg != "" {
+		return fmt.Errorf("%w: %s", kind, msg)
+	}
+	return fmt.Errorf("%w: %v", kind, err)
+}
+
+// encryptSecret writes the ciphertext next to path and renames it into place
+// so a failed run never leaves a truncated secret behind.
 func encryptSecret(value, path string) error {
-	cmd := exec.Command("age", "-R", recipientsFile, "-o", path)
-	cmd.Stdin = strings.NewReader(value)
-	return cmd.Run()
+	recipients, err := effectiveRecipients()
+	if err != nil {
+		return fmt.Errorf("reading recipients: %w", err)
+	}
+	if err := checkRecipientFeatures(recipients); err != nil {
+		return err
+	}
+	if err := requireMinRecipients(); err != nil {
+		return err
+	}
+	if err := requireSelf(recipients); err != nil {
+		return err
+	}
+	args, err := recipientArgs()
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	args = append(args, "-o", tmpPath)
+
+	var stderr bytes.Buffer
+	err = withRetry("age", func() error {
+		cmd, err := ageCommand(args...)
+		if err != nil {
+			return err
+		}
+		stderr.Reset()
+		cmd.Stdin = strings.NewReader(value)
+		cmd.Stderr = &stderr
+		return cmd.Run()
+	})
+	if err != nil {
+		os.Remove(tmpPath)
+		return ageError(err, stderr.Bytes(), errEncrypt)
+	}
+	// age creates the file according to the umask; set the mode explicitly
+	if err := os.Chmod(tmpPath, secretFileMode()); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	if recordsRecipients(path) {
+		if len(recipients) == 0 {
+			removeSidecar(path)
+		} else if err := writeSidecar(path, recipients); err != nil {
+			printWarning("Warning: recording recipients: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// encryptFor encrypts value to the given recipient keys alone, none of the
+// store's, and writes the age file to w.
+func encryptFor(w io.Writer, value string, keys []string, armor bool) error {
+	var args []string
+	if armor {
+		args = append(args, "-a")
+	}
+	for _, key := range keys {
+		args = append(args, "-r", key)
+	}
+	var stdout, stderr bytes.Buffer
+	err := withRetry("age", func() error {
+		cmd, err := ageCommand(args...)
+		if err != nil {
+			return err
+		}
+		stdout.Reset()
+		stderr.Reset()
+		cmd.Stdin = strings.NewReader(value)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		return cmd.Run()
+	})
+	if err != nil {
+		return ageError(err, stderr.Bytes(), errEncrypt)
+	}
+	_, err = w.Write(stdout.Bytes())
+	return err
 }
 
 func decryptSecret(path string) (string, error) {
-	keyPath := strings.Replace(defaultKeyPath, "~", os.Getenv("HOME"), 1)
-	cmd := exec.Command("age", "-d", "-i", keyPath, path)
-	output, err := cmd.Output()
-	return string(output), err
+	if isPassphraseSecret(path) {
+		return decryptPassphraseSecret(path)
+	}
+	data, err := readSecretFile(path)
+	if err != nil {
+		return "", err
+	}
+	return decryptData(data, path)
 }
 
-func getSecretNames() []string {
-	files, err := filepath.Glob(filepath.Join(secretsDir, "*.age"))
+// decryptData decrypts an age file held in memory, read from name, with the
+// identities in use: $AGE_IDENTITY or --identity-stdin, every --decrypt-with
+// in turn, or --key. It is the part of decryptSecret that doesn't need the
+// file, which doctor's round trip shares so as to test what get does.
+func decryptData(data []byte, name string) (string, error) {
+	if len(decryptWith) > 0 {
+		return decryptWithChain(data, name)
+	}
+	if ids, ok, err := memoryIdentities(); ok {
+		if err != nil {
+			return "", err
+		}
+		return decryptNativeData(data, ids)
+	}
+	return decryptDataWith(data, identityPath())
+}
+
+// readSecretFile reads the age file at path, where a missing file is a
+// missing secret.
+func readSecretFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, path)
+	}
+	return data, err
+}
+
+// identityPath returns the identity file with ~ expanded.
+func identityPath() string {
+	return expandHome(keyPath)
+}
+
+// expandHome replaces a leading ~ with the user's home directory.
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return os.Getenv("HOME") + path[1:]
+	}
+	return path
+}
+
+func decryptSecretWith(path, keyPath string) (string, error) {
+	data, err := readSecretFile(path)
 	if err != nil {
-		return nil
+		return "", err
 	}
+	return decryptDataWith(data, keyPath)
+}
+
+// decryptDataWith decrypts an age file held in memory with the identity
+// file at keyPath.
+func decryptDataWith(data []byte, keyPath string) (string, error) {
+	if isEncryptedIdentity(keyPath) {
+		// age would ask for the passphrase again for every secret
+		ids, err := unlockIdentity(keyPath)
+		if err != nil {
+			return "", err
+		}
+		return decryptNativeData(data, ids)
+	}
+
+	var stderr bytes.Buffer
+	var output []byte
+	err := withRetry("age", func() error {
+		cmd, err := ageCommand("-d", "-i", keyPath)
+		if err != nil {
+			return err
+		}
+		stderr.Reset()
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Stderr = &stderr
+		output, err = cmd.Output()
+		return err
+	})
+	if err != nil {
+		return "", ageError(err, stderr.Bytes(), ErrDecrypt)
+	}
+	return string(output), nil
+}
 
+// looksEncrypted reports whether content is an age file, armored or not,
+// which as a decrypted value suggests it was encrypted twice.
+func looksEncrypted(content string) bool {
+	return strings.HasPrefix(content, ageIntro+"\n") ||
+		strings.HasPrefix(strings.TrimSpace(content), armorHeader)
+}
+
+// isBinary reports whether content looks like binary data rather than text.
+func isBinary(content string) bool {
+	return !utf8.ValidString(content) || strings.ContainsRune(content, 0)
+}
+
+// warnIfStale prints an advisory to stderr when the secret at path has not
+// been modified for longer than the configured warn_after.
+func warnIfStale(path string) {
+	if cfg.WarnAfter <= 0 {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if age := time.Since(info.ModTime()); age > time.Duration(cfg.WarnAfter) {
+		printWarning("Warning: this secret is %d days old; consider rotating\n", int(age.Hours()/24))
+	}
+}
+
+// completeSecretNames offers the secrets and namespaces directly inside the
+// namespace being typed, so "aws/" completes to what is under secrets/aws
+// rather than the whole store.
+func completeSecretNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	dir := ""
+	if i := strings.LastIndex(toComplete, "/"); i >= 0 {
+		dir = toComplete[:i+1]
+	}
+	if dir != "" && !filepath.IsLocal(strings.TrimSuffix(dir, "/")) {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	entries, err := os.ReadDir(filepath.Join(secretsDir, filepath.FromSlash(dir)))
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	directive := cobra.ShellCompDirectiveNoFileComp
 	var names []string
-	for _, file := range files {
-		name := filepath.Base(file)
+	for _, e := range entries {
+		name := dir + e.Name()
+		switch {
+		case strings.HasPrefix(e.Name(), "."):
+			continue
+		case e.IsDir():
+			name += "/"
+		case !strings.HasSuffix(name, ".age"):
+			continue
+		}
+		if !strings.HasPrefix(name, toComplete) {
+			continue
+		}
+		name = displayName(name)
+		if e.IsDir() {
+			// Let the user keep typing into the namespace
+			directive |= cobra.ShellCompDirectiveNoSpace
+		}
 		names = append(names, name)
 	}
+	return names, directive
+}
+
+// resolveSecret normalizes a secret name to carry the .age suffix and returns
+// it along with its path. Names may contain slashes to form namespaces but
+// must stay inside the secrets directory.
+func resolveSecret(name string) (string, string, error) {
+	canonical := normalizeName(name)
+	if !filepath.IsLocal(canonical) || filepath.Base(canonical) == ".age" {
+		return "", "", fmt.Errorf("%w: invalid secret name %q", ErrUsage, name)
+	}
+	return canonical, filepath.Join(secretsDir, filepath.FromSlash(canonical)), nil
+}
+
+// defaultNamePattern keeps whitespace and control characters out of names
+// when the config sets no name_pattern.
+var defaultNamePattern = regexp.MustCompile(`^[^\s\p{Cc}\p{Zs}]+$`)
+
+// checkNewName enforces the naming rules of the config on canonical name,
+// which is about to be created. Secrets that already exist are not checked,
+// so that they can still be updated after the rules tighten.
+func checkNewName(name string) error {
+	shown := strings.TrimSuffix(name, ".age")
+	for _, reserved := range cfg.ReservedNames {
+		if normalizeName(reserved) == name {
+			return fmt.Errorf("%w: %q is a reserved name", ErrUsage, shown)
+		}
+	}
+	if cfg.namePattern != nil {
+		if !cfg.namePattern.MatchString(shown) {
+			return fmt.Errorf("%w: %q does not match name_pattern %s", ErrUsage, shown, cfg.NamePattern)
+		}
+	} else if !defaultNamePattern.MatchString(shown) {
+		return fmt.Errorf("%w: %q contains whitespace or control characters", ErrUsage, shown)
+	}
+	return nil
+}
+
+// keepSuffix is bound to --keep-suffix.
+var keepSuffix bool
+
+// normalizeName returns the canonical form of a secret name as given by the
+// user, with or without .age: slash-separated, cleaned, relative to the
+// store and ending in .age. Backslashes count as separators on every
+// platform. Everything inside works on canonical names, including
+// meta.json, the audit log and hook arguments.
+func normalizeName(name string) string {
+	name = strings.Trim(strings.ReplaceAll(name, `\`, "/"), "/")
+	if !strings.HasSuffix(name, ".age") {
+		name += ".age"
+	}
+	return path.Clean(name)
+}
+
+// displayName returns a canonical name as output shows it: without .age,
+// unless --keep-suffix is set.
+func displayName(name string) string {
+	if keepSuffix {
+		return name
+	}
+	return strings.TrimSuffix(name, ".age")
+}
+
+func displayNames(names []string) []string {
+	shown := make([]string, len(names))
+	for i, name := range names {
+		shown[i] = displayName(name)
+	}
+	return shown
+}
+
+// makeSecretDir creates dir and any missing parents with the directory mode
+// of the store. Directories that already exist keep their mode.
+func makeSecretDir(dir string) error {
+	var missing []string
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		missing = append(missing, d)
+	}
+	if err := os.MkdirAll(dir, secretDirMode()); err != nil {
+		return err
+	}
+	// MkdirAll is subject to the umask too
+	for _, d := range missing {
+		if err := os.Chmod(d, secretDirMode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSecretFile writes data to path with the mode of secret files,
+// through a temporary file renamed into place.
+func writeSecretFile(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, secretFileMode()); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, secretFileMode()); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// resolvePrefix returns name unchanged if it is a secret, and otherwise the
+// one secret whose name starts with it. Several matches are an error
+// listing them; no match leaves name for the caller to report as missing.
+func resolvePrefix(name string) (string, error) {
+	// "aws/" isn't a valid secret name but is a fine prefix
+	if _, path, err := resolveSecret(name); err == nil {
+		if _, err := os.Stat(path); err == nil {
+			return name, nil
+		}
+	}
+	var matches []string
+	for _, candidate := range getSecretNames() {
+		if strings.HasPrefix(candidate, name) {
+			matches = append(matches, candidate)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return name, nil
+	case 1:
+		printVerbose("Using %s for %s\n", displayName(matches[0]), name)
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("%w: %q matches several secrets: %s", ErrUsage, name, strings.Join(displayNames(matches), ", "))
+}
+
+// getSecretNames returns the names of all secrets, including those in
+// namespaces, as slash-separated paths relative to secretsDir.
+func getSecretNames() []string {
+	return secretNamesIn(secretsDir)
+}
+
+// secretNamesIn lists the secrets in the store directory dir.
+func secretNamesIn(dir string) []string {
+	var names []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			// Hidden directories hold tool state, not secrets
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".age") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err == nil {
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return nil
+	})
 	return names
 }
 
+// excludePatterns is bound to --exclude on the bulk commands.
+var excludePatterns []string
+
+// excludeSecrets drops the names matching any --exclude pattern, matched
+// with filepath.Match against the name without .age, and returns how many
+// were dropped.
+func excludeSecrets(names []string) ([]string, int, error) {
+	if len(excludePatterns) == 0 {
+		return names, 0, nil
+	}
+	var kept []string
+	for _, name := range names {
+		excluded := false
+		for _, pattern := range excludePatterns {
+			match, err := filepath.Match(pattern, strings.TrimSuffix(name, ".age"))
+			if err != nil {
+				return nil, 0, fmt.Errorf("%w: invalid --exclude pattern %q", ErrUsage, pattern)
+			}
+			if match {
+				excluded = true
+				break
+			}
+		}
+		if excluded {
+			printVerbose("Excluding %s\n", displayName(name))
+		} else {
+			kept = append(kept, name)
+		}
+	}
+	return kept, len(names) - len(kept), nil
+}
+
+// excludedNote is the suffix of a summary line for n excluded secrets.
+func excludedNote(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d excluded)", n)
+}
+
+func init() {
+	addCmd.Flags().Bool("binary", false, "read raw bytes from stdin until EOF instead of a single line")
+	addCmd.Flags().String("description", "", "store a non-secret description of the secret in meta.json")
+	addCmd.Flags().Bool("passphrase", false, "encrypt with a passphrase, asked for on the terminal, instead of to the recipients")
+	addCmd.Flags().String("from-file", "", "read the secret value from a file, byte for byte")
+	addCmd.Flags().String("prompt", "Enter secret value: ", "text to prompt for the value with")
+	addCmd.Flags().BoolP("multiline", "m", false, "read every line up to EOF (Ctrl-D) instead of a single line")
+	addCmd.Flags().Bool("check-drift", false, "afterwards, warn if other secrets differ from the current recipients (see rekey_on_add)")
+	for _, c := range []*cobra.Command{addCmd, editCmd} {
+		c.Flags().BoolVar(&recordRecipientsFlag, "record-recipients", false, "list the recipients in a .recipients file next to the secret (see record_recipients)")
+		c.Flags().BoolVar(&confirmRecipientsFlag, "confirm-recipients", false, "list the recipients and, on a terminal, ask before encrypting (see confirm_recipients)")
+	}
+	editCmd.Flags().Bool("create", false, "create the secret if it does not exist")
+	editCmd.Flags().Bool("force", false, "edit even if the secret holds binary data")
+	for _, c := range []*cobra.Command{addCmd, editCmd, removeCmd, rekeyCmd, statusCmd, mergeCmd, importSopsCmd, setCmd, unsetCmd, trashRestoreCmd, trashEmptyCmd} {
+		c.Flags().BoolVar(&dryRun, "dry-run", false, "print the changes that would be made without making them")
+	}
+	for _, c := range []*cobra.Command{rekeyCmd, statusCmd, decryptAllCmd, verifyCmd} {
+		c.Flags().StringArrayVar(&excludePatterns, "exclude", nil, "skip secrets whose name without .age matches this glob (repeatable)")
+	}
+	for _, c := range []*cobra.Command{addCmd, editCmd} {
+		c.Flags().BoolP("yes", "y", false, "accept the first-run setup without prompting")
+		c.Flags().Bool("no-warn-placeholder", false, "skip the placeholder recipient check")
+	}
+	getCmd.Flags().Bool("binary", false, "write the raw decrypted bytes to stdout")
+	getCmd.Flags().Bool("raw", false, "same as --binary")
+	encryptCmd.Flags().StringArrayP("recipient", "r", nil, "public key to encrypt to instead of the recipients (repeatable)")
+	encryptCmd.Flags().BoolP("armor", "a", false, "write ASCII-armored output")
+	encryptCmd.Flags().StringP("output", "o", "", "write the age file here with 0600 permissions instead of stdout")
+	decryptCmd.Flags().StringP("output", "o", "", "write the plaintext to this file with 0600 permissions instead of stdout")
+	getCmd.Flags().StringP("output", "o", "", "write the value to this file with 0600 permissions instead of stdout")
+	getCmd.Flags().Bool("fifo", false, "print the path of a named pipe and write the value to the first reader of it")
+	getCmd.Flags().Duration("fifo-timeout", 30*time.Second, "how long --fifo waits for a reader")
+	getCmd.Flags().String("format", "text", "output format: text, or json for an object with the name and value")
+	getCmd.Flags().Bool("with-metadata", false, "with --format json, add mtime, size, recipient_count, description and expires")
+	getCmd.Flags().Bool("confirm", false, "reveal a protected secret without asking")
+	getCmd.Flags().Bool("prefix", false, "accept a unique prefix of the secret name")
+	getCmd.Flags().String("jsonpath", "", "print only the field at this path of a JSON secret, e.g. .client.keys[0].id")
+	getCmd.Flags().String("yaml-key", "", "print only the value at this dotted key of a YAML secret, e.g. db.hosts[0]")
+	getCmd.Flags().String("toml-key", "", "print only the value at this dotted key of a TOML secret, e.g. server.port")
+	getCmd.Flags().String("default", "", "print this instead of failing when the secret does not exist")
+	getCmd.Flags().Duration("cache-ttl", 0, "reuse the decrypted value for this long, e.g. 5m (0 disables the cache)")
+	getCmd.Flags().Int("line", 0, "print only line N (1-based)")
+	getCmd.Flags().String("lines", "", "print only lines M:N (1-based, inclusive)")
+	getCmd.Flags().String("bytes", "", "print only bytes start:end (0-based, end exclusive)")
+}
+
 func main() {
-	rootCmd.AddCommand(generateCmd, addCmd, editCmd, getCmd)
+	rootCmd.PersistentFlags().StringVar(&secretsDir, "dir", secretsDir, "directory holding the encrypted secrets")
+	rootCmd.PersistentFlags().StringArrayVar(&recipientsFiles, "recipients", recipientsFiles, "recipients file to encrypt to; repeat to merge several")
+	rootCmd.PersistentFlags().StringVar(&keyPath, "key", keyPath, "age identity file used to decrypt")
+	rootCmd.PersistentFlags().StringVar(&profileFlag, "profile", "", "use the store of this profile from the config ($SECRETS_PROFILE also works)")
+	rootCmd.MarkPersistentFlagDirname("dir")
+	rootCmd.MarkPersistentFlagFilename("recipients")
+	rootCmd.MarkPersistentFlagFilename("key")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "suppress status and error messages; rely on the exit code")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "print diagnostic details to stderr")
+	rootCmd.PersistentFlags().StringArrayVar(&decryptWith, "decrypt-with", nil, "identity file to try instead of --key; repeat to try several in order")
+	rootCmd.PersistentFlags().BoolVar(&identityStdin, "identity-stdin", false, "read the identity from stdin instead of the key file ($AGE_IDENTITY also works)")
+	rootCmd.PersistentFlags().StringVar(&ageBinaryFlag, "age-binary", "", "age executable to use (default $AGE_BINARY or age on PATH)")
+	rootCmd.PersistentFlags().IntVar(&retries, "retries", retries, "times to retry an external command that fails to start")
+	rootCmd.PersistentFlags().StringVar(&recipientsCommandFlag, "recipients-command", "", "shell command whose output replaces the recipients file")
+	rootCmd.PersistentFlags().StringVar(&hookFlag, "hook", "", "shell command to run after a successful change (overrides post_hook)")
+	rootCmd.PersistentFlags().BoolVar(&keepSuffix, "keep-suffix", false, "show secret names with their .age suffix")
+	rootCmd.PersistentFlags().StringVar(&modeFlag, "mode", "", "permissions of the secret files written, e.g. 0640 (overrides secret_mode; default 0600)")
+	rootCmd.PersistentFlags().BoolVar(&allowLockout, "allow-lockout", false, "encrypt even if your own identity is not a recipient")
+	rootCmd.PersistentFlags().BoolVar(&strictHook, "strict-hook", false, "fail the command if the post hook fails")
+	rootCmd.Version = currentBuild().String()
+	rootCmd.SetVersionTemplate("{{.Version}}\n")
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return fmt.Errorf("%w: %v", ErrUsage, err)
+	})
+
+	rootCmd.AddCommand(generateCmd, generatePasswordCmd, addCmd, editCmd, setCmd, unsetCmd, getCmd, existsCmd, encryptCmd, decryptCmd, revealCmd, copyCmd, recipientsCmd, accessMatrixCmd, reencryptToCmd, reencryptCmd, doctorCmd, removeCmd, envCmd, templateCmd, watchCmd, decryptAllCmd, verifyCmd, shareCmd, recoverCmd, mergeCmd, importCmd, infoCmd, listCmd, searchCmd, describeCmd, protectCmd, statsCmd, statusCmd, rekeyCmd, lockCmd, auditCmd, trashCmd, profileCmd, keygenCmd, syncCmd, installHooksCmd, gitHookCmd, versionCmd, clearClipboardCmd)
 
 	// Add completion command
 	rootCmd.AddCommand(&cobra.Command{
@@ -211,7 +1439,9 @@ func main() {
 	})
 
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		if !quiet && !errors.Is(err, errAbsent) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(exitCode(err))
 	}
 }
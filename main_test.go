@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"filippo.io/age"
+)
+
+var (
+	testIdentityOnce sync.Once
+	testIdentity     *age.X25519Identity
+)
+
+// useTestStore points the store at a new temporary directory for the length
+// of the test and returns the identity that testSecret encrypts to. It is
+// handed to the code under test through $AGE_IDENTITY, which is read once
+// per process, so every test shares it and no age binary is needed.
+func useTestStore(tb testing.TB) *age.X25519Identity {
+	tb.Helper()
+	testIdentityOnce.Do(func() {
+		id, err := age.GenerateX25519Identity()
+		if err != nil {
+			panic(err)
+		}
+		testIdentity = id
+		os.Setenv("AGE_IDENTITY", id.String())
+	})
+	oldDir, oldQuiet := secretsDir, quiet
+	secretsDir, quiet = tb.TempDir(), true
+	tb.Cleanup(func() { secretsDir, quiet = oldDir, oldQuiet })
+	return testIdentity
+}
+
+// testSecret encrypts value to the test identity as secret name and returns
+// the path of its file.
+func testSecret(tb testing.TB, name string, value []byte) string {
+	tb.Helper()
+	path := filepath.Join(secretsDir, filepath.FromSlash(normalizeName(name)))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		tb.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	w, err := age.Encrypt(f, testIdentity.Recipient())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := w.Write(value); err != nil {
+		tb.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"db", "db.age"},
+		{"db.age", "db.age"},
+		{"prod/db", "prod/db.age"},
+		{"prod/db.age", "prod/db.age"},
+		{"/prod/db", "prod/db.age"},
+		{"prod/db/", "prod/db.age"},
+		{"//prod//db", "prod/db.age"},
+		{"./prod/./db", "prod/db.age"},
+		{"prod/staging/../db", "prod/db.age"},
+		{"../db", "../db.age"},
+		{`prod\db`, "prod/db.age"},
+		{`\prod\db.age`, "prod/db.age"},
+		{"", ".age"},
+	}
+	for _, tt := range tests {
+		if got := normalizeName(tt.in); got != tt.want {
+			t.Errorf("normalizeName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestResolveSecretRejects(t *testing.T) {
+	for _, name := range []string{"", "/", "../db", "prod/../../db", `..\db`} {
+		if _, _, err := resolveSecret(name); exitCode(err) != exitUsage {
+			t.Errorf("resolveSecret(%q) = %v, want a usage error", name, err)
+		}
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	tests := []struct {
+		in         string
+		keepSuffix bool
+		want       string
+	}{
+		{"db.age", false, "db"},
+		{"prod/db.age", false, "prod/db"},
+		{"prod/db.age", true, "prod/db.age"},
+		{"backup.tar.age", false, "backup.tar"},
+	}
+	defer func(old bool) { keepSuffix = old }(keepSuffix)
+	for _, tt := range tests {
+		keepSuffix = tt.keepSuffix
+		if got := displayName(tt.in); got != tt.want {
+			t.Errorf("displayName(%q) with keepSuffix %v = %q, want %q", tt.in, tt.keepSuffix, got, tt.want)
+		}
+	}
+}
+
+func TestNameRoundTrip(t *testing.T) {
+	defer func(old bool) { keepSuffix = old }(keepSuffix)
+	for _, keep := range []bool{false, true} {
+		keepSuffix = keep
+		for _, in := range []string{"db", "prod/db", "/prod//db/", "./prod/x/../db.age", `prod\db`} {
+			canonical := normalizeName(in)
+			shown := displayName(canonical)
+			if again := normalizeName(shown); again != canonical {
+				t.Errorf("keepSuffix %v: %q shown as %q normalizes to %q, not %q", keep, in, shown, again, canonical)
+			}
+			if !keep && shown+".age" != canonical {
+				t.Errorf("displayName(%q) = %q, want it without .age", canonical, shown)
+			}
+		}
+	}
+}
+
+// captureStdout runs fn with os.Stdout redirected to a file and returns what
+// was written to it.
+func captureStdout(t *testing.T, fn func() error) []byte {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	old := os.Stdout
+	os.Stdout = f
+	err = fn()
+	os.Stdout = old
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestGetRawRoundTrip(t *testing.T) {
+	useTestStore(t)
+	random := make([]byte, 4096)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string][]byte{
+		"random":          random,
+		"nul bytes":       {0, 0, 'a', 0, 'b', 0},
+		"invalid utf-8":   {0xff, 0xfe, 0xc3, 0x28, 0xa0, 0xa1, 0xe2, 0x28},
+		"crlf":            []byte("line one\r\nline two\r\n"),
+		"trailing \\n":    []byte("value\n"),
+		"no trailing \\n": []byte("value"),
+		"mixed":           append(append([]byte("head\x00\r\n"), random[:256]...), '\n'),
+	}
+	if err := getCmd.Flags().Set("raw", "true"); err != nil {
+		t.Fatal(err)
+	}
+	defer getCmd.Flags().Set("raw", "false")
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			testSecret(t, "binary/value", value)
+			got := captureStdout(t, func() error {
+				return getCmd.RunE(getCmd, []string{"binary/value"})
+			})
+			if !bytes.Equal(got, value) {
+				t.Errorf("get --raw wrote %d bytes %q, want %d bytes %q", len(got), trimForLog(got), len(value), trimForLog(value))
+			}
+		})
+	}
+}
+
+func trimForLog(b []byte) []byte {
+	if len(b) > 32 {
+		return b[:32]
+	}
+	return b
+}
+
+func TestReadValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		multiline bool
+		want      string
+	}{
+		{"trailing newline stripped", "secret\n", false, "secret"},
+		{"no trailing newline", "secret", false, "secret"},
+		{"crlf stripped", "secret\r\n", false, "secret"},
+		{"empty", "", false, ""},
+		{"empty line", "\n", false, ""},
+		{"only the first line", "one\ntwo\n", false, "one"},
+		{"spaces kept", "  pass phrase  \n", false, "  pass phrase  "},
+		{"multiline kept", "one\ntwo\n", true, "one\ntwo\n"},
+		{"multiline crlf kept", "one\r\ntwo", true, "one\r\ntwo"},
+		{"multiline empty", "", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A plain reader, and a file that is not a terminal, as stdin
+			// is when piped
+			f, err := os.CreateTemp(t.TempDir(), "stdin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if _, err := f.WriteString(tt.input); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range []io.Reader{strings.NewReader(tt.input), f} {
+				var prompt bytes.Buffer
+				got, err := readValue(r, &prompt, "Value: ", tt.multiline)
+				if err != nil {
+					t.Fatalf("readValue(%T): %v", r, err)
+				}
+				if got != tt.want {
+					t.Errorf("readValue(%T) = %q, want %q", r, got, tt.want)
+				}
+				if prompt.String() != "Value: " {
+					t.Errorf("readValue(%T) prompted %q, want %q", r, prompt.String(), "Value: ")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge [other-secrets-dir]",
+	Short: "Copy the secrets of another store into this one",
+	Long: `Copy every secret from another store's secrets directory into this one.
+--on-conflict decides what happens when a secret of the same name exists
+with different content: skip it, overwrite it, or rename the incoming one
+to name-merged. With --rekey, incoming secrets are decrypted and encrypted
+to this store's recipients rather than copied as they are, which needs an
+identity that can read them.`,
+	Args: usageArgs(cobra.ExactArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		onConflict, _ := cmd.Flags().GetString("on-conflict")
+		rekey, _ := cmd.Flags().GetBool("rekey")
+		if onConflict != "skip" && onConflict != "overwrite" && onConflict != "rename" {
+			return fmt.Errorf("%w: --on-conflict must be skip, overwrite or rename", ErrUsage)
+		}
+		otherDir := args[0]
+		if info, err := os.Stat(otherDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("%s is not a secrets directory", otherDir)
+		}
+		if same, _ := sameDir(otherDir, secretsDir); same {
+			return fmt.Errorf("%w: %s is this store", ErrUsage, otherDir)
+		}
+		if rekey && !dryRun {
+			if err := requireMinRecipients(); err != nil {
+				return err
+			}
+		}
+
+		var res bulkResult
+		for _, name := range secretNamesIn(otherDir) {
+			src := filepath.Join(otherDir, filepath.FromSlash(name))
+			data, err := ioutil.ReadFile(src)
+			if err != nil {
+				res.fail(name, err)
+				continue
+			}
+
+			target := name
+			existing, err := ioutil.ReadFile(filepath.Join(secretsDir, filepath.FromSlash(name)))
+			if err == nil {
+				if bytes.Equal(existing, data) {
+					printVerbose("%s is already identical\n", displayName(name))
+					continue
+				}
+				switch onConflict {
+				case "skip":
+					printStatus("- %s: exists, skipped\n", displayName(name))
+					res.Skipped = append(res.Skipped, name)
+					continue
+				case "rename":
+					target = freeName(name)
+				}
+			}
+
+			dst := filepath.Join(secretsDir, filepath.FromSlash(target))
+			if dryRun {
+				printDryRun("write %s from %s", dst, src)
+				continue
+			}
+			if err := mergeSecret(src, dst, data, rekey); err != nil {
+				res.fail(name, err)
+				continue
+			}
+			if target != name {
+				printStatus("✓ %s -> %s\n", displayName(name), displayName(target))
+			} else {
+				printStatus("✓ %s\n", displayName(name))
+			}
+			res.Processed = append(res.Processed, target)
+		}
+		if dryRun {
+			return nil
+		}
+
+		for _, name := range res.Failed {
+			printWarning("✗ %s: %v\n", displayName(name), res.Errors[name])
+		}
+		printStatus("✓ Merged %d secrets (%d skipped)\n", len(res.Processed), len(res.Skipped))
+		if len(res.Processed) > 0 {
+			if err := runHook("merge", res.Processed...); err != nil {
+				return err
+			}
+		}
+		if len(res.Failed) > 0 {
+			return fmt.Errorf("%d secrets could not be merged: %s", len(res.Failed), strings.Join(displayNames(res.Failed), ", "))
+		}
+		return nil
+	},
+}
+
+// mergeSecret writes an incoming secret to dst, re-encrypted to the current
+// recipients if rekey is set or copied verbatim otherwise.
+func mergeSecret(src, dst string, data []byte, rekey bool) error {
+	if err := makeSecretDir(filepath.Dir(dst)); err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+	if rekey {
+		content, err := decryptSecret(src)
+		if err != nil {
+			return fmt.Errorf("decrypting secret: %w", err)
+		}
+		return encryptSecret(content, dst)
+	}
+	// Who the copy is encrypted to is unknown here
+	removeSidecar(dst)
+	return writeSecretFile(dst, data)
+}
+
+// freeName returns name with a -merged suffix, numbered if needed, that no
+// secret in the store uses yet.
+func freeName(name string) string {
+	base := strings.TrimSuffix(name, ".age")
+	for i := 1; ; i++ {
+		candidate := base + "-merged.age"
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-merged-%d.age", base, i)
+		}
+		if _, err := os.Stat(filepath.Join(secretsDir, filepath.FromSlash(candidate))); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// sameDir reports whether a and b are the same directory.
+func sameDir(a, b string) (bool, error) {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(ai, bi), nil
+}
+
+func init() {
+	mergeCmd.Flags().String("on-conflict", "skip", "what to do with secrets that exist with other content: skip, overwrite or rename")
+	mergeCmd.Flags().Bool("rekey", false, "re-encrypt incoming secrets to the current recipients")
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// secretMeta is the non-secret information kept about a secret in
+// meta.json, in plaintext, so it can be read without the identity.
+type secretMeta struct {
+	Description string `json:"description,omitempty"`
+	// Protected secrets are only revealed after confirmation.
+	Protected bool `json:"protected,omitempty"`
+}
+
+func metaPath() string {
+	return filepath.Join(secretsDir, "meta.json")
+}
+
+// loadMeta reads the metadata of all secrets, keyed by secret name. A
+// missing file means no secret has any.
+func loadMeta() (map[string]secretMeta, error) {
+	meta := map[string]secretMeta{}
+	data, err := ioutil.ReadFile(metaPath())
+	if os.IsNotExist(err) {
+		return meta, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading metadata: %w", err)
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", metaPath(), err)
+	}
+	return meta, nil
+}
+
+// saveMeta writes meta back, dropping empty entries, and removes the file
+// once nothing is left in it.
+func saveMeta(meta map[string]secretMeta) error {
+	for name, m := range meta {
+		if m == (secretMeta{}) {
+			delete(meta, name)
+		}
+	}
+	if len(meta) == 0 {
+		if err := os.Remove(metaPath()); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing metadata: %w", err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := metaPath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing metadata: %w", err)
+	}
+	return os.Rename(tmpPath, metaPath())
+}
+
+func setDescription(name, description string) error {
+	meta, err := loadMeta()
+	if err != nil {
+		return err
+	}
+	m := meta[name]
+	m.Description = description
+	meta[name] = m
+	return saveMeta(meta)
+}
+
+// confirmReveal guards protected secrets: interactively it asks before
+// revealing, otherwise it needs confirmed, which is --confirm. The question
+// goes to stderr so it doesn't end up wherever stdout is redirected.
+func confirmReveal(name string, confirmed bool) error {
+	if confirmed {
+		return nil
+	}
+	secretName, _, err := resolveSecret(name)
+	if err != nil {
+		return err
+	}
+	meta, err := loadMeta()
+	if err != nil {
+		return err
+	}
+	if !meta[secretName].Protected {
+		return nil
+	}
+	if !isTerminal(os.Stdin) {
+		return fmt.Errorf("%w: %s is protected; pass --confirm to reveal it", ErrUsage, displayName(secretName))
+	}
+	fmt.Fprintf(os.Stderr, "%s is protected. Reveal it? [y/N]: ", displayName(secretName))
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	if answer := strings.ToLower(strings.TrimSpace(scanner.Text())); answer != "y" && answer != "yes" {
+		return errors.New("not revealed")
+	}
+	return nil
+}
+
+// forgetMeta drops the metadata of secrets that were removed.
+func forgetMeta(names ...string) error {
+	meta, err := loadMeta()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, name := range names {
+		if _, ok := meta[name]; ok {
+			delete(meta, name)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveMeta(meta)
+}
+
+var describeCmd = &cobra.Command{
+	Use:               "describe [secret-name] [description]",
+	Short:             "Show or set the description of a secret",
+	Long:              "Show or set the description of a secret. Pass an empty description to clear it. Descriptions are stored unencrypted in meta.json.",
+	Args:              usageArgs(cobra.RangeArgs(1, 2)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		secretName, secretPath, err := resolveSecret(args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(secretPath); os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrSecretNotFound, displayName(secretName))
+		}
+
+		if len(args) == 1 {
+			meta, err := loadMeta()
+			if err != nil {
+				return err
+			}
+			if d := meta[secretName].Description; d != "" {
+				fmt.Println(d)
+			}
+			return nil
+		}
+
+		if err := setDescription(secretName, args[1]); err != nil {
+			return err
+		}
+		printStatus("✓ Description of '%s' updated\n", displayName(secretName))
+		return runHook("describe", secretName)
+	},
+}
+
+var protectCmd = &cobra.Command{
+	Use:   "protect [secret-name]",
+	Short: "Require confirmation before a secret is revealed",
+	Long: `Mark a secret as protected. get, copy and reveal then ask before showing
+it, or fail without --confirm when there is no terminal to ask on. --off
+removes the mark.`,
+	Args:              usageArgs(cobra.ExactArgs(1)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		off, _ := cmd.Flags().GetBool("off")
+		secretName, secretPath, err := resolveSecret(args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(secretPath); os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrSecretNotFound, displayName(secretName))
+		}
+
+		meta, err := loadMeta()
+		if err != nil {
+			return err
+		}
+		m := meta[secretName]
+		m.Protected = !off
+		meta[secretName] = m
+		if err := saveMeta(meta); err != nil {
+			return err
+		}
+		if off {
+			printStatus("✓ '%s' is no longer protected\n", displayName(secretName))
+		} else {
+			printStatus("✓ '%s' is protected\n", displayName(secretName))
+		}
+		return runHook("protect", secretName)
+	},
+}
+
+func init() {
+	protectCmd.Flags().Bool("off", false, "remove the protection")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"filippo.io/age"
+	"golang.org/x/term"
+)
+
+// secretPassphrases remembers the passphrase of each passphrase secret
+// decrypted so far, by path, so edit can encrypt the result to the same
+// passphrase and nothing asks twice.
+var secretPassphrases = map[string]string{}
+
+// readPassphrase asks for a passphrase on the terminal without echoing it.
+// With twice set it is asked for again, for a new passphrase; the two must
+// match.
+func readPassphrase(prompt string, twice bool) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", errors.New("a passphrase is needed and there is no terminal to ask on")
+	}
+	defer tty.Close()
+	read := func(prompt string) ([]byte, error) {
+		fmt.Fprint(tty, prompt)
+		b, err := term.ReadPassword(int(tty.Fd()))
+		fmt.Fprintln(tty)
+		if err != nil {
+			return nil, fmt.Errorf("reading passphrase: %w", err)
+		}
+		return b, nil
+	}
+
+	first, err := read(prompt)
+	if err != nil {
+		return "", err
+	}
+	// The string copy can't be cleared; this at least drops the buffers
+	defer clear(first)
+	if twice {
+		second, err := read("Confirm passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		defer clear(second)
+		if !bytes.Equal(first, second) {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	if len(first) == 0 {
+		return "", errors.New("empty passphrase")
+	}
+	return string(first), nil
+}
+
+// isPassphraseSecret reports whether the secret at path is encrypted with a
+// passphrase rather than to recipients, which its header records.
+func isPassphraseSecret(path string) bool {
+	stanzas, err := readHeader(path)
+	return err == nil && len(stanzas) > 0 && recipientStanzas(stanzas) == 0
+}
+
+// decryptPassphraseSecret asks for the passphrase of the secret at path and
+// decrypts it.
+func decryptPassphraseSecret(path string) (string, error) {
+	passphrase, ok := secretPassphrases[path]
+	if !ok {
+		var err error
+		if passphrase, err = readPassphrase(fmt.Sprintf("Passphrase for %s: ", path), false); err != nil {
+			return "", err
+		}
+	}
+	id, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return "", err
+	}
+	content, err := decryptNative(path, []age.Identity{id})
+	if errors.Is(err, ErrDecrypt) {
+		return "", fmt.Errorf("%w: wrong passphrase for %s, or the file is damaged", ErrDecrypt, path)
+	}
+	if err != nil {
+		return "", err
+	}
+	secretPassphrases[path] = passphrase
+	return content, nil
+}
+
+// encryptWithPassphrase encrypts value to path with age's scrypt
+// passphrase encryption instead of to the recipients.
+func encryptWithPassphrase(value, path, passphrase string) error {
+	r, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errEncrypt, err)
+	}
+	if _, err := w.Write([]byte(value)); err != nil {
+		return fmt.Errorf("%w: %v", errEncrypt, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("%w: %v", errEncrypt, err)
+	}
+	if err := writeSecretFile(path, buf.Bytes()); err != nil {
+		return err
+	}
+	removeSidecar(path)
+	return nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	passwordAlphanumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	passwordSymbols      = "!#$%&()*+,-./:;<=>?@[]^_{|}~"
+	passwordHex          = "0123456789abcdef"
+	// passwordAmbiguous are characters easily mistaken for one another
+	passwordAmbiguous = "O0l1I"
+)
+
+// passwordCharset resolves a --charset value: a named set or, failing
+// that, the characters to use.
+func passwordCharset(name string, noAmbiguous bool) (string, error) {
+	charset := name
+	switch name {
+	case "alnum":
+		charset = passwordAlphanumeric
+	case "alnumsym":
+		charset = passwordAlphanumeric + passwordSymbols
+	case "hex":
+		charset = passwordHex
+	}
+	var b strings.Builder
+	seen := map[rune]bool{}
+	for _, r := range charset {
+		// Repeats would make a character more likely than the others
+		if seen[r] || noAmbiguous && strings.ContainsRune(passwordAmbiguous, r) {
+			continue
+		}
+		seen[r] = true
+		b.WriteRune(r)
+	}
+	if b.Len() < 2 {
+		return "", fmt.Errorf("%w: the character set must have at least two characters", ErrUsage)
+	}
+	return b.String(), nil
+}
+
+// charClass sorts a character into lower case, upper case, digit or other.
+func charClass(r rune) int {
+	switch {
+	case unicode.IsLower(r):
+		return 0
+	case unicode.IsUpper(r):
+		return 1
+	case unicode.IsDigit(r):
+		return 2
+	}
+	return 3
+}
+
+var generatePasswordCmd = &cobra.Command{
+	Use:   "generate-password [secret-name]",
+	Short: "Generate a random password, optionally storing and copying it",
+	Long: `Generate a random password. With a secret name it is stored as that
+secret; with --copy it goes to the clipboard. Pass --show=false to keep it
+off the screen entirely.`,
+	Args:              usageArgs(cobra.MaximumNArgs(1)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		length, _ := cmd.Flags().GetInt("length")
+		symbols, _ := cmd.Flags().GetBool("symbols")
+		charsetName, _ := cmd.Flags().GetString("charset")
+		noAmbiguous, _ := cmd.Flags().GetBool("no-ambiguous")
+		require, _ := cmd.Flags().GetBool("require")
+		copyIt, _ := cmd.Flags().GetBool("copy")
+		show, _ := cmd.Flags().GetBool("show")
+		force, _ := cmd.Flags().GetBool("force")
+		clearAfter, _ := cmd.Flags().GetDuration("clear-after")
+
+		if length < 1 {
+			return fmt.Errorf("%w: --length must be positive", ErrUsage)
+		}
+		if !show && !copyIt && len(args) == 0 {
+			return fmt.Errorf("%w: with --show=false the password must be stored or copied", ErrUsage)
+		}
+
+		var secretName, secretPath string
+		if len(args) == 1 {
+			var err error
+			secretName, secretPath, err = resolveSecret(args[0])
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(secretPath); err == nil && !force {
+				return fmt.Errorf("%s already exists; pass --force to replace it", displayName(secretName))
+			} else if os.IsNotExist(err) {
+				if err := checkNewName(secretName); err != nil {
+					return err
+				}
+			}
+			if err := requireMinRecipients(); err != nil {
+				return err
+			}
+		}
+
+		var clip clipboardTool
+		if copyIt {
+			var err error
+			if clip, err = findClipboard(); err != nil {
+				return err
+			}
+		}
+
+		if symbols {
+			if cmd.Flags().Changed("charset") {
+				return fmt.Errorf("%w: --symbols and --charset cannot be combined", ErrUsage)
+			}
+			charsetName = "alnumsym"
+		}
+		charset, err := passwordCharset(charsetName, noAmbiguous)
+		if err != nil {
+			return err
+		}
+		password, err := randomPassword(length, charset, require)
+		if err != nil {
+			return err
+		}
+
+		if secretName != "" {
+			if err := makeSecretDir(filepath.Dir(secretPath)); err != nil {
+				return fmt.Errorf("creating directory: %w", err)
+			}
+			if err := encryptSecret(password, secretPath); err != nil {
+				return fmt.Errorf("encrypting secret: %w", err)
+			}
+			printStatus("✓ Secret '%s' encrypted\n", displayName(secretName))
+		}
+		if copyIt {
+			if err := clip.write(password); err != nil {
+				return fmt.Errorf("copying to clipboard: %w", err)
+			}
+			if clearAfter > 0 {
+				if err := scheduleClipboardClear(password, clearAfter); err != nil {
+					return fmt.Errorf("scheduling clipboard clear: %w", err)
+				}
+				printStatus("✓ Copied to the clipboard; clearing in %s\n", clearAfter)
+			} else {
+				printStatus("✓ Copied to the clipboard\n")
+			}
+		}
+		if show {
+			fmt.Println(password)
+		}
+		if secretName != "" {
+			return runHook("generate-password", secretName)
+		}
+		return nil
+	},
+}
+
+// randomPassword picks length characters uniformly from charset. With
+// require, it includes at least one character of each class (lower case,
+// upper case, digit, other) found in charset: passwords lacking one are
+// thrown away and drawn again, which keeps every valid password equally
+// likely, unlike patching in the missing characters.
+func randomPassword(length int, charset string, require bool) (string, error) {
+	chars := []rune(charset)
+	classes := map[int]bool{}
+	for _, r := range chars {
+		classes[charClass(r)] = true
+	}
+	if require && length < len(classes) {
+		return "", fmt.Errorf("%w: --require needs a length of at least %d for this character set", ErrUsage, len(classes))
+	}
+
+	max := big.NewInt(int64(len(chars)))
+	for attempt := 0; attempt < 1000; attempt++ {
+		password := make([]rune, length)
+		found := map[int]bool{}
+		for i := range password {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", fmt.Errorf("generating password: %w", err)
+			}
+			password[i] = chars[n.Int64()]
+			found[charClass(password[i])] = true
+		}
+		if !require || len(found) == len(classes) {
+			return string(password), nil
+		}
+	}
+	return "", errors.New("could not generate a password including every character class; try a longer --length")
+}
+
+func init() {
+	generatePasswordCmd.Flags().Int("length", 24, "number of characters")
+	generatePasswordCmd.Flags().Bool("symbols", false, "include punctuation (same as --charset alnumsym)")
+	generatePasswordCmd.Flags().String("charset", "alnum", "alnum, alnumsym, hex, or the characters to pick from")
+	generatePasswordCmd.Flags().Bool("no-ambiguous", false, "leave out easily confused characters ("+passwordAmbiguous+")")
+	generatePasswordCmd.Flags().Bool("require", false, "include at least one character of each kind in the set: lower, upper, digit, other")
+	generatePasswordCmd.Flags().Bool("copy", false, "copy the password to the clipboard")
+	generatePasswordCmd.Flags().Bool("show", true, "print the password")
+	generatePasswordCmd.Flags().Bool("force", false, "replace an existing secret")
+	generatePasswordCmd.Flags().Duration("clear-after", 45*time.Second, "with --copy, clear the clipboard after this long (0 to keep it)")
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// profile is a named store from the config: where its secrets are, who
+// they are encrypted to and the identity that decrypts them. Fields left
+// out keep their defaults.
+type profile struct {
+	SecretsDir     string `json:"secrets_dir"`
+	RecipientsFile string `json:"recipients_file"`
+	KeyPath        string `json:"key_path"`
+}
+
+// profileFlag is bound to --profile.
+var profileFlag string
+
+// activeProfile is the name of the profile in use, if any.
+var activeProfile string
+
+// applyProfile switches to the profile chosen with --profile or
+// $SECRETS_PROFILE. --dir, --recipients and --key still win over it.
+func applyProfile(cmd *cobra.Command) error {
+	name := profileFlag
+	if name == "" {
+		name = os.Getenv("SECRETS_PROFILE")
+	}
+	if name == "" {
+		return nil
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return fmt.Errorf("%w: no profile %q in %s", ErrUsage, name, configPath())
+	}
+	activeProfile = name
+	if p.SecretsDir != "" && !cmd.Flags().Changed("dir") {
+		secretsDir = expandHome(p.SecretsDir)
+	}
+	if p.RecipientsFile != "" && !cmd.Flags().Changed("recipients") {
+		recipientsFiles = []string{expandHome(p.RecipientsFile)}
+	}
+	if p.KeyPath != "" && !cmd.Flags().Changed("key") {
+		keyPath = p.KeyPath
+	}
+	return nil
+}
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "List and show the store profiles of the config",
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List profiles, marking the one in use",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names := make([]string, 0, len(cfg.Profiles))
+		for name := range cfg.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			printStatus("No profiles in %s\n", configPath())
+			return nil
+		}
+		for _, name := range names {
+			mark := " "
+			if name == activeProfile {
+				mark = "*"
+			}
+			fmt.Printf("%s %s\n", mark, name)
+		}
+		return nil
+	},
+}
+
+var profileShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Show the paths of a profile, or those in use",
+	Long: `Show the secrets directory, recipients files and identity of the named
+profile, or without a name, the ones this command would use, after flags
+and $SECRETS_PROFILE. Paths a profile leaves out are shown as they are now.`,
+	Args: usageArgs(cobra.MaximumNArgs(1)),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		var names []string
+		for name := range cfg.Profiles {
+			names = append(names, name)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, files, key := secretsDir, recipientsFiles, keyPath
+		name := activeProfile
+		if len(args) == 1 {
+			name = args[0]
+			p, ok := cfg.Profiles[name]
+			if !ok {
+				return fmt.Errorf("%w: no profile %q in %s", ErrUsage, name, configPath())
+			}
+			if p.SecretsDir != "" {
+				dir = expandHome(p.SecretsDir)
+			}
+			if p.RecipientsFile != "" {
+				files = []string{expandHome(p.RecipientsFile)}
+			}
+			if p.KeyPath != "" {
+				key = p.KeyPath
+			}
+		}
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Printf("profile:     %s\n", name)
+		fmt.Printf("secrets_dir: %s\n", dir)
+		for _, f := range files {
+			fmt.Printf("recipients:  %s\n", f)
+		}
+		fmt.Printf("key_path:    %s\n", key)
+		return nil
+	},
+}
+
+func init() {
+	profileCmd.AddCommand(profileListCmd, profileShowCmd)
+}
@@ -0,0 +1,760 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+// recipient is a single key line from the recipients file together with the
+// comment line directly above it, if any.
+type recipient struct {
+	Key     string
+	Comment string
+	Line    int
+}
+
+// recipientID returns the part of a recipient line that identifies the key.
+// SSH keys carry a trailing free-form comment that must not affect equality.
+func recipientID(key string) string {
+	fields := strings.Fields(key)
+	if len(fields) == 0 {
+		return ""
+	}
+	if strings.HasPrefix(fields[0], "ssh-") && len(fields) > 1 {
+		return fields[0] + " " + fields[1]
+	}
+	return fields[0]
+}
+
+// loadRecipients parses the recipients file. A comment line immediately
+// preceding a key is attached to that key.
+func loadRecipients(path string) ([]recipient, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseRecipients(data), nil
+}
+
+func parseRecipients(data []byte) []recipient {
+	var recipients []recipient
+	comment := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			comment = ""
+		case strings.HasPrefix(line, "#"):
+			comment = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		default:
+			recipients = append(recipients, recipient{Key: line, Comment: comment, Line: i + 1})
+			comment = ""
+		}
+	}
+	return recipients
+}
+
+// appendRecipient adds key to the recipients file unless an entry with the
+// same key already exists. It reports whether the file was changed.
+func appendRecipient(key, comment string) (bool, error) {
+	data, err := ioutil.ReadFile(recipientsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("reading recipients file: %w", err)
+	}
+	for _, r := range parseRecipients(data) {
+		if recipientID(r.Key) == recipientID(key) {
+			return false, nil
+		}
+	}
+
+	entry := key + "\n"
+	if comment != "" {
+		entry = "# " + comment + "\n" + entry
+	}
+	// Keep the new entry from running into an unterminated last line
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		entry = "\n" + entry
+	}
+	if err := writeRecipientsFile(append(data, entry...)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removeRecipient deletes key, and the comment attached to it, from the
+// recipients file. It reports whether the file was changed.
+func removeRecipient(key string) (bool, error) {
+	data, err := ioutil.ReadFile(recipientsFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading recipients file: %w", err)
+	}
+	drop := map[int]bool{}
+	for _, r := range parseRecipients(data) {
+		if recipientID(r.Key) != recipientID(key) {
+			continue
+		}
+		drop[r.Line-1] = true
+		if r.Comment != "" {
+			drop[r.Line-2] = true
+		}
+	}
+	if len(drop) == 0 {
+		return false, nil
+	}
+
+	var kept []string
+	for i, line := range strings.Split(string(data), "\n") {
+		if !drop[i] {
+			kept = append(kept, line)
+		}
+	}
+	if err := writeRecipientsFile([]byte(strings.Join(kept, "\n"))); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeRecipientsFile replaces the recipients file with data in canonical
+// form, so that tools editing it in turn don't leave formatting noise in
+// its history.
+func writeRecipientsFile(data []byte) error {
+	tmpPath := recipientsFile + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, canonicalRecipients(data), 0644); err != nil {
+		return fmt.Errorf("writing recipients file: %w", err)
+	}
+	if err := os.Rename(tmpPath, recipientsFile); err != nil {
+		return fmt.Errorf("writing recipients file: %w", err)
+	}
+	return nil
+}
+
+// canonicalRecipients normalizes the layout of recipients file data: \n
+// line endings, no trailing whitespace, no runs of blank lines and no
+// blank lines at either end, and a final newline. Lines keep their order.
+func canonicalRecipients(data []byte) []byte {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	var b strings.Builder
+	blank := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line == "" {
+			blank = b.Len() > 0
+			continue
+		}
+		if blank {
+			b.WriteString("\n")
+			blank = false
+		}
+		b.WriteString(line + "\n")
+	}
+	return []byte(b.String())
+}
+
+// printChanged reports the outcome of an idempotent change, as
+// {"changed": bool} with --json so tools can detect drift.
+func printChanged(cmd *cobra.Command, changed bool, message string) error {
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		return json.NewEncoder(os.Stdout).Encode(struct {
+			Changed bool `json:"changed"`
+		}{changed})
+	}
+	printStatus("✓ %s\n", message)
+	return nil
+}
+
+// recipientsCommandFlag is set by --recipients-command and overrides
+// recipients_command from the config.
+var recipientsCommandFlag string
+
+var (
+	commandRecipientsOnce sync.Once
+	commandRecipients     []recipient
+	commandRecipientsErr  error
+)
+
+func recipientsCommand() string {
+	if recipientsCommandFlag != "" {
+		return recipientsCommandFlag
+	}
+	return cfg.RecipientsCommand
+}
+
+// recipientsSource describes where effectiveRecipients reads from.
+func recipientsSource() string {
+	if c := recipientsCommand(); c != "" {
+		return fmt.Sprintf("recipients command %q", c)
+	}
+	if len(recipientsFiles) > 1 {
+		return "recipients files " + strings.Join(recipientsFiles, ", ")
+	}
+	return "recipients file " + recipientsFile
+}
+
+// effectiveRecipients returns the recipients to encrypt to: the output of
+// the recipients command when one is configured, otherwise the recipients
+// file. Command output is fetched once per invocation.
+func effectiveRecipients() ([]recipient, error) {
+	command := recipientsCommand()
+	if command == "" && len(recipientsFiles) > 1 {
+		return mergeRecipients(recipientsFiles)
+	}
+	if command == "" {
+		return loadRecipients(recipientsFile)
+	}
+	commandRecipientsOnce.Do(func() {
+		commandRecipients, commandRecipientsErr = runRecipientsCommand(command)
+	})
+	return commandRecipients, commandRecipientsErr
+}
+
+// mergeRecipients reads several recipients files and returns their distinct
+// recipients in order. When a key appears more than once, the first comment
+// found for it is kept.
+func mergeRecipients(files []string) ([]recipient, error) {
+	var merged []recipient
+	index := map[string]int{}
+	for _, file := range files {
+		recipients, err := loadRecipients(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading recipients file: %w", err)
+		}
+		for _, r := range recipients {
+			id := recipientID(r.Key)
+			if i, ok := index[id]; ok {
+				if merged[i].Comment == "" {
+					merged[i].Comment = r.Comment
+				}
+				continue
+			}
+			index[id] = len(merged)
+			merged = append(merged, r)
+		}
+	}
+	return merged, nil
+}
+
+func runRecipientsCommand(command string) ([]recipient, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running recipients command: %w", err)
+	}
+	recipients := parseRecipients(out)
+	if len(recipients) == 0 {
+		return nil, errors.New("recipients command printed no recipients")
+	}
+	for _, r := range recipients {
+		if err := validateRecipient(r.Key); err != nil {
+			return nil, fmt.Errorf("recipients command output line %d: %w", r.Line, err)
+		}
+	}
+	return recipients, nil
+}
+
+// bech32Charset is the alphabet of the data part of age recipients.
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// validateRecipient checks that key has the shape of an age X25519, age
+// plugin or SSH recipient. It does not prove the key is usable.
+func validateRecipient(key string) error {
+	fields := strings.Fields(key)
+	switch recipientType(key) {
+	case "":
+		if len(fields) == 0 {
+			return errors.New("empty recipient")
+		}
+	case "ssh":
+		if len(fields) < 2 {
+			return fmt.Errorf("%s key has no key data", fields[0])
+		}
+		if _, err := base64.StdEncoding.DecodeString(fields[1]); err != nil {
+			return fmt.Errorf("%s key data is not valid base64", fields[0])
+		}
+		return nil
+	case "age", "plugin":
+		if len(fields) > 1 {
+			return errors.New("age recipients must be a single word")
+		}
+		data := key[strings.LastIndex(key, "1")+1:]
+		if strings.Trim(data, bech32Charset) != "" {
+			return fmt.Errorf("%q is not a valid age recipient", truncateKey(key))
+		}
+		if !isPluginRecipient(key) && len(key) != 62 {
+			return fmt.Errorf("%q has the wrong length for an X25519 recipient", truncateKey(key))
+		}
+		return nil
+	}
+	return fmt.Errorf("unrecognized recipient type %q", truncateKey(fields[0]))
+}
+
+// recipientType is the kind of recipient key is by its prefix: "age" for
+// X25519, "ssh" or "plugin", or "" if it is none of them.
+func recipientType(key string) string {
+	fields := strings.Fields(key)
+	switch {
+	case len(fields) == 0:
+		return ""
+	case fields[0] == "ssh-ed25519" || fields[0] == "ssh-rsa":
+		return "ssh"
+	case isPluginRecipient(fields[0]):
+		return "plugin"
+	case strings.HasPrefix(fields[0], "age1"):
+		return "age"
+	}
+	return ""
+}
+
+// hasRecipient reports whether key is among the effective recipients.
+func hasRecipient(key string) bool {
+	recipients, _ := effectiveRecipients()
+	for _, r := range recipients {
+		if recipientID(r.Key) == recipientID(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowLockout is bound to --allow-lockout.
+var allowLockout bool
+
+// requireSelf refuses to encrypt to recipients that don't include one of
+// the identities used to decrypt, which would leave the new file readable
+// by others but not by whoever wrote it. It is skipped when the identity's
+// public key can't be worked out, or when require_self is false.
+func requireSelf(recipients []recipient) error {
+	// With no recipients at all, age's own error says more
+	if allowLockout || len(recipients) == 0 || (cfg.RequireSelf != nil && !*cfg.RequireSelf) {
+		return nil
+	}
+	self, ok := selfRecipients()
+	if !ok {
+		printVerbose("Not checking that you are a recipient: no public key for the identity\n")
+		return nil
+	}
+	for _, r := range recipients {
+		for _, key := range self {
+			if recipientID(r.Key) == recipientID(key) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("your identity (%s) is not among the recipients, so you could not decrypt this; add it with recipients add, or pass --allow-lockout", truncateKey(self[0]))
+}
+
+// requireMinRecipients enforces the min_recipients policy on the current
+// recipients.
+func requireMinRecipients() error {
+	if cfg.MinRecipients <= 0 {
+		return nil
+	}
+	recipients, err := effectiveRecipients()
+	if err != nil {
+		return fmt.Errorf("reading recipients: %w", err)
+	}
+	if len(recipients) < cfg.MinRecipients {
+		return fmt.Errorf("min_recipients requires at least %d recipients, but only %d are configured", cfg.MinRecipients, len(recipients))
+	}
+	return nil
+}
+
+// confirmRecipientsFlag is bound to --confirm-recipients on add and edit.
+var confirmRecipientsFlag bool
+
+// confirmRecipients lists the recipients a secret is about to be encrypted
+// to, when --confirm-recipients or confirm_recipients asks for it, and on a
+// terminal waits for a yes. Elsewhere the list is only printed.
+func confirmRecipients() error {
+	if !confirmRecipientsFlag && !cfg.ConfirmRecipients {
+		return nil
+	}
+	recipients, err := effectiveRecipients()
+	if err != nil {
+		return fmt.Errorf("reading recipients: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Encrypting to %d recipients from %s:\n", len(recipients), recipientsSource())
+	for _, r := range recipients {
+		if r.Comment != "" {
+			fmt.Fprintf(os.Stderr, "  - %s (%s)\n", r.Comment, truncateKey(r.Key))
+		} else {
+			fmt.Fprintf(os.Stderr, "  - %s\n", r.Key)
+		}
+	}
+	if isTerminal(os.Stdin) && !confirm("Encrypt to these recipients?") {
+		return errors.New("aborted; nothing was encrypted")
+	}
+	return nil
+}
+
+// recipientArgs returns the age flags selecting the effective recipients.
+func recipientArgs() ([]string, error) {
+	// Merged files are passed key by key so that duplicates between them
+	// don't produce duplicate stanzas
+	if recipientsCommand() == "" && len(recipientsFiles) == 1 {
+		return []string{"-R", recipientsFile}, nil
+	}
+	recipients, err := effectiveRecipients()
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	for _, r := range recipients {
+		args = append(args, "-r", r.Key)
+	}
+	return args, nil
+}
+
+var recipientsCmd = &cobra.Command{
+	Use:   "recipients",
+	Short: "Manage the recipients file",
+}
+
+var recipientsAddCmd = &cobra.Command{
+	Use:   "add [public-key]",
+	Short: "Add a public key to the recipients file",
+	Args:  usageArgs(cobra.MinimumNArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// SSH keys contain spaces, so accept the key unquoted as several args
+		key := strings.Join(args, " ")
+		comment, _ := cmd.Flags().GetString("comment")
+		if err := validateRecipient(key); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrUsage, truncateKey(key), err)
+		}
+
+		added, err := appendRecipient(key, comment)
+		if err != nil {
+			return err
+		}
+		if !added {
+			return printChanged(cmd, false, "Recipient already present")
+		}
+		return printChanged(cmd, true, "Recipient added")
+	},
+}
+
+var recipientsRemoveCmd = &cobra.Command{
+	Use:   "remove [public-key]",
+	Short: "Remove a public key from the recipients file",
+	Long: `Remove a public key, and the comment above it, from the recipients file.
+Removing a key that isn't there succeeds without changing anything. Run
+rekey afterwards to stop encrypting existing secrets to it.`,
+	Args: usageArgs(cobra.MinimumNArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		removed, err := removeRecipient(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return printChanged(cmd, false, "Recipient not present")
+		}
+		return printChanged(cmd, true, "Recipient removed")
+	},
+}
+
+var recipientsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recipients and their comments",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		recipients, err := effectiveRecipients()
+		if err != nil {
+			return fmt.Errorf("reading recipients: %w", err)
+		}
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			type recipientJSON struct {
+				Key     string `json:"key"`
+				Comment string `json:"comment"`
+				Type    string `json:"type"`
+			}
+			out := []recipientJSON{}
+			for _, r := range recipients {
+				out = append(out, recipientJSON{r.Key, r.Comment, recipientType(r.Key)})
+			}
+			s, err := encodeJSON(out)
+			if err != nil {
+				return err
+			}
+			fmt.Println(s)
+			return nil
+		}
+		for _, r := range recipients {
+			if r.Comment != "" {
+				fmt.Printf("%s  # %s\n", r.Key, r.Comment)
+			} else {
+				fmt.Println(r.Key)
+			}
+		}
+		printVerbose("%d distinct recipients from %s\n", len(recipients), recipientsSource())
+		return nil
+	},
+}
+
+var recipientsExpiredCmd = &cobra.Command{
+	Use:   "expired",
+	Short: "List recipients whose expiry date has passed",
+	Long: `List the recipients whose comment carries an expiry date that has passed,
+e.g. "# bob (contractor), expires 2025-01-01". A key expires at the start
+of that day. Existing secrets stay encrypted to expired recipients until
+rekey --drop-expired removes them and re-encrypts the store.`,
+	Args: usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		recipients, err := effectiveRecipients()
+		if err != nil {
+			return fmt.Errorf("reading recipients: %w", err)
+		}
+		expired := expiredRecipients(recipients, time.Now())
+		for _, r := range expired {
+			fmt.Printf("%s  # %s\n", r.Key, r.Comment)
+		}
+		printVerbose("%d of %d recipients expired\n", len(expired), len(recipients))
+		return nil
+	},
+}
+
+// expiryPattern finds the date in an "expires YYYY-MM-DD" recipient comment.
+var expiryPattern = regexp.MustCompile(`\bexpires (\d{4}-\d{2}-\d{2})\b`)
+
+// recipientExpiry returns the expiry date in the comment of r, if it has a
+// valid one.
+func recipientExpiry(r recipient) (time.Time, bool) {
+	m := expiryPattern.FindStringSubmatch(r.Comment)
+	if m == nil {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(time.DateOnly, m[1], time.Local)
+	return t, err == nil
+}
+
+// expiredRecipients returns the recipients whose expiry date is not after
+// now.
+func expiredRecipients(recipients []recipient, now time.Time) []recipient {
+	var expired []recipient
+	for _, r := range recipients {
+		if t, ok := recipientExpiry(r); ok && !now.Before(t) {
+			expired = append(expired, r)
+		}
+	}
+	return expired
+}
+
+var recipientsSortCmd = &cobra.Command{
+	Use:   "sort",
+	Short: "Sort the recipients file and remove duplicate keys",
+	Long: `Sort the recipients file and remove duplicate keys. Comment lines directly
+above a key move with it; other comments are kept together at the top. The
+original is saved as a .bak file next to it.`,
+	Args: usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := ioutil.ReadFile(recipientsFile)
+		if err != nil {
+			return fmt.Errorf("reading recipients file: %w", err)
+		}
+		for _, r := range parseRecipients(data) {
+			if err := validateRecipient(r.Key); err != nil {
+				return fmt.Errorf("%s line %d: %w", recipientsFile, r.Line, err)
+			}
+		}
+
+		sorted, duplicates := sortRecipients(data)
+		if bytes.Equal(sorted, data) {
+			printStatus("✓ %s is already sorted\n", recipientsFile)
+			return nil
+		}
+		if err := ioutil.WriteFile(recipientsFile+".bak", data, 0644); err != nil {
+			return fmt.Errorf("backing up recipients file: %w", err)
+		}
+		tmpPath := recipientsFile + ".tmp"
+		if err := ioutil.WriteFile(tmpPath, sorted, 0644); err != nil {
+			return fmt.Errorf("writing recipients file: %w", err)
+		}
+		if err := os.Rename(tmpPath, recipientsFile); err != nil {
+			return fmt.Errorf("writing recipients file: %w", err)
+		}
+		printStatus("✓ Sorted %s (%d duplicates removed; original saved as %s.bak)\n", recipientsFile, duplicates, recipientsFile)
+		return nil
+	},
+}
+
+var recipientsCanonicalizeCmd = &cobra.Command{
+	Use:   "canonicalize",
+	Short: "Normalize line endings, whitespace and blank lines in the recipients file",
+	Long: `Rewrite the recipients file with \n line endings, without trailing
+whitespace or runs of blank lines, and with a single final newline. The
+order of keys and comments is kept. recipients add and remove write the
+file this way too.`,
+	Args: usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := ioutil.ReadFile(recipientsFile)
+		if err != nil {
+			return fmt.Errorf("reading recipients file: %w", err)
+		}
+		if bytes.Equal(canonicalRecipients(data), data) {
+			return printChanged(cmd, false, recipientsFile+" is already canonical")
+		}
+		if err := writeRecipientsFile(data); err != nil {
+			return err
+		}
+		return printChanged(cmd, true, "Canonicalized "+recipientsFile)
+	},
+}
+
+var recipientsDeriveCmd = &cobra.Command{
+	Use:   "derive [identity-file...]",
+	Short: "Print the public recipients of identity files",
+	Long: `Print the public recipient of every identity in the given identity files,
+or in the configured key file, in the format of .age-recipients. SSH and
+plugin identities are read from the .pub file next to them, or asked for.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		paths := args
+		if len(paths) == 0 {
+			paths = []string{keyPath}
+		}
+		failed := 0
+		for _, p := range paths {
+			keys, err := deriveRecipients(expandHome(p))
+			if err == nil && len(keys) == 0 {
+				err = errors.New("no identities found")
+			}
+			if err != nil {
+				printWarning("✗ %s: %v\n", p, err)
+				failed++
+				continue
+			}
+			for _, key := range keys {
+				fmt.Printf("%s  # %s\n", key, p)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d identity files could not be read", failed)
+		}
+		return nil
+	},
+}
+
+var recipientsValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check that every line of the recipients file is a valid recipient",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		valid, err := validateRecipientsFiles()
+		if err != nil {
+			return err
+		}
+		printStatus("✓ %d recipients are valid\n", valid)
+		return nil
+	},
+}
+
+// validateRecipientsFiles checks every recipient in the recipients files,
+// reporting each invalid one, and returns how many are valid.
+func validateRecipientsFiles() (int, error) {
+	valid, invalid := 0, 0
+	for _, file := range recipientsFiles {
+		recipients, err := loadRecipients(file)
+		if err != nil {
+			return 0, fmt.Errorf("reading recipients file: %w", err)
+		}
+		for _, r := range recipients {
+			if err := validateRecipient(r.Key); err != nil {
+				printWarning("✗ %s:%d: %v\n", file, r.Line, err)
+				invalid++
+				continue
+			}
+			valid++
+		}
+	}
+	if invalid > 0 {
+		return valid, fmt.Errorf("%d invalid recipients", invalid)
+	}
+	return valid, nil
+}
+
+// sortRecipients returns the recipients file data with its keys sorted and
+// deduplicated, along with the number of duplicates dropped. Unlike
+// parseRecipients, it keeps the whole block of comment lines directly above
+// a key attached to it.
+func sortRecipients(data []byte) ([]byte, int) {
+	type entry struct {
+		key      string
+		comments []string
+	}
+	var (
+		header  []string
+		pending []string
+		entries []entry
+		seen    = map[string]int{}
+		dups    int
+	)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			header = append(header, pending...)
+			pending = nil
+		case strings.HasPrefix(line, "#"):
+			pending = append(pending, line)
+		default:
+			id := recipientID(line)
+			if i, ok := seen[id]; ok {
+				// Keep the first copy, but don't lose a comment only the
+				// duplicate had
+				if len(entries[i].comments) == 0 {
+					entries[i].comments = pending
+				}
+				dups++
+			} else {
+				seen[id] = len(entries)
+				entries = append(entries, entry{line, pending})
+			}
+			pending = nil
+		}
+	}
+	header = append(header, pending...)
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return recipientID(entries[i].key) < recipientID(entries[j].key)
+	})
+
+	var b strings.Builder
+	for _, line := range header {
+		b.WriteString(line + "\n")
+	}
+	if len(header) > 0 && len(entries) > 0 {
+		b.WriteString("\n")
+	}
+	for _, e := range entries {
+		for _, c := range e.comments {
+			b.WriteString(c + "\n")
+		}
+		b.WriteString(e.key + "\n")
+	}
+	return []byte(b.String()), dups
+}
+
+func init() {
+	recipientsAddCmd.Flags().String("comment", "", "comment written above the key, e.g. the owner's email")
+	recipientsListCmd.Flags().Bool("json", false, "print an array of {key, comment, type} objects, type being age, ssh or plugin")
+	for _, c := range []*cobra.Command{recipientsAddCmd, recipientsRemoveCmd, recipientsCanonicalizeCmd} {
+		c.Flags().Bool("json", false, `print {"changed": true|false} instead of a message`)
+	}
+	recipientsCmd.AddCommand(recipientsAddCmd, recipientsCanonicalizeCmd, recipientsDeriveCmd, recipientsExpiredCmd, recipientsImportCmd, recipientsListCmd, recipientsRemoveCmd, recipientsSortCmd, recipientsValidateCmd)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var removeCmd = &cobra.Command{
+	Use:               "remove [secret-name]",
+	Short:             "Remove a secret or, with --recursive, a namespace",
+	Args:              usageArgs(cobra.ExactArgs(1)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		recursive, _ := cmd.Flags().GetBool("recursive")
+		force, _ := cmd.Flags().GetBool("force")
+		hard, _ := cmd.Flags().GetBool("hard")
+		trash := useTrash() && !hard
+
+		if recursive {
+			return removeNamespace(args[0], force, trash)
+		}
+
+		secretName, secretPath, err := resolveSecret(args[0])
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(strings.TrimSuffix(secretPath, ".age")); err == nil && info.IsDir() {
+			if _, err := os.Stat(secretPath); os.IsNotExist(err) {
+				return fmt.Errorf("%w: %s is a namespace; pass --recursive to remove it", ErrUsage, args[0])
+			}
+		}
+		if dryRun {
+			if _, err := os.Stat(secretPath); os.IsNotExist(err) {
+				return fmt.Errorf("%w: %s", ErrSecretNotFound, displayName(secretName))
+			}
+			printDryRun("%s %s", removeVerb(trash), secretPath)
+			return nil
+		}
+		if err := removeSecretFile(secretName, trash); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%w: %s", ErrSecretNotFound, displayName(secretName))
+			}
+			return fmt.Errorf("removing secret: %w", err)
+		}
+		pruneEmptyDirs(filepath.Dir(secretPath))
+		if err := forgetMeta(secretName); err != nil {
+			printWarning("Warning: %v\n", err)
+		}
+		if trash {
+			printStatus("✓ Secret '%s' moved to the trash\n", displayName(secretName))
+		} else {
+			printStatus("✓ Secret '%s' removed\n", displayName(secretName))
+		}
+		return runHook("remove", secretName)
+	},
+}
+
+// removeSecretFile moves secret name to the trash, or deletes it if trash
+// is false, along with its recorded recipients.
+func removeSecretFile(name string, trash bool) error {
+	path := filepath.Join(secretsDir, filepath.FromSlash(name))
+	if trash {
+		return trashSecret(name)
+	}
+	err := os.Remove(path)
+	if err == nil {
+		removeSidecar(path)
+	}
+	return err
+}
+
+func removeVerb(trash bool) string {
+	if trash {
+		return "move to the trash"
+	}
+	return "delete"
+}
+
+// removeNamespace deletes every secret under the namespace directory ns
+// after listing them and asking for confirmation, unless force is set.
+// With trash, they are moved to the trash instead.
+func removeNamespace(ns string, force, trash bool) error {
+	clean := filepath.Clean(ns)
+	if !filepath.IsLocal(clean) {
+		return fmt.Errorf("%w: invalid namespace %q", ErrUsage, ns)
+	}
+	if clean == "." {
+		return fmt.Errorf("%w: refusing to remove the secrets directory itself", ErrUsage)
+	}
+	dir := filepath.Join(secretsDir, clean)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%w: no namespace %s", ErrSecretNotFound, ns)
+	}
+
+	prefix := filepath.ToSlash(clean) + "/"
+	var names []string
+	for _, name := range getSecretNames() {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("%w: no secrets under %s", ErrSecretNotFound, ns)
+	}
+
+	if dryRun {
+		for _, name := range names {
+			printDryRun("%s %s", removeVerb(trash), filepath.Join(secretsDir, filepath.FromSlash(name)))
+		}
+		return nil
+	}
+
+	if !force {
+		fmt.Printf("This will remove %d secrets:\n", len(names))
+		for _, name := range names {
+			fmt.Printf("  %s\n", displayName(name))
+		}
+		if !confirm("Continue?") {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	var removed []string
+	for _, name := range names {
+		path := filepath.Join(secretsDir, filepath.FromSlash(name))
+		if err := removeSecretFile(name, trash); err != nil {
+			printWarning("✗ %s: %v\n", displayName(name), err)
+			continue
+		}
+		removed = append(removed, name)
+		pruneEmptyDirs(filepath.Dir(path))
+	}
+
+	if err := forgetMeta(removed...); err != nil {
+		printWarning("Warning: %v\n", err)
+	}
+	if trash {
+		printStatus("✓ Moved %d secrets to the trash\n", len(removed))
+	} else {
+		printStatus("✓ Removed %d secrets\n", len(removed))
+	}
+	if len(removed) > 0 {
+		if err := runHook("remove", removed...); err != nil {
+			return err
+		}
+	}
+	if len(removed) < len(names) {
+		return fmt.Errorf("%d secrets could not be removed", len(names)-len(removed))
+	}
+	return nil
+}
+
+// pruneEmptyDirs removes dir and its parents while they are empty, stopping
+// at secretsDir.
+func pruneEmptyDirs(dir string) {
+	root := filepath.Clean(secretsDir)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
+func init() {
+	removeCmd.Flags().BoolP("recursive", "r", false, "remove all secrets under a namespace")
+	removeCmd.Flags().BoolP("force", "f", false, "do not ask for confirmation")
+	removeCmd.Flags().Bool("hard", false, "delete for good instead of moving to the trash")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var revealCmd = &cobra.Command{
+	Use:   "reveal [secret-name]",
+	Short: "Show a secret briefly, then clear it from the terminal",
+	Long: `Print a secret, wait for a key press or --timeout, then erase it from the
+terminal. Scrollback that already holds it is out of reach. When stdout
+is not a terminal it behaves like get.`,
+	Args:              usageArgs(cobra.ExactArgs(1)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		backend, name, err := backendFor(args[0])
+		if err != nil {
+			return err
+		}
+		_, isAge := backend.(ageBackend)
+		if isAge {
+			confirmed, _ := cmd.Flags().GetBool("confirm")
+			if err := confirmReveal(name, confirmed); err != nil {
+				return err
+			}
+		}
+		data, err := backend.Get(name)
+		if err != nil {
+			return err
+		}
+		if isAge {
+			secretName, _, _ := resolveSecret(name)
+			recordAudit("reveal", secretName)
+		}
+
+		if !isTerminal(os.Stdout) || !isTerminal(os.Stdin) {
+			_, err := os.Stdout.Write(data)
+			return err
+		}
+		content := strings.TrimSuffix(string(data), "\n")
+		hint := fmt.Sprintf("(press any key to hide, or wait %s)", timeout)
+		fmt.Printf("%s\n%s", content, hint)
+		waitForKey(timeout)
+		clearLines(screenLines(content+"\n"+hint, int(os.Stdout.Fd())))
+		return nil
+	},
+}
+
+// waitForKey returns after a key press on the terminal or after timeout.
+func waitForKey(timeout time.Duration) {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		time.Sleep(timeout)
+		return
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+
+	pressed := make(chan struct{})
+	go func() {
+		b := make([]byte, 1)
+		os.Stdin.Read(b)
+		close(pressed)
+	}()
+	select {
+	case <-pressed:
+	case <-time.After(timeout):
+	}
+}
+
+// screenLines counts the terminal rows text takes up, with long lines
+// wrapping at the terminal width.
+func screenLines(text string, fd int) int {
+	width, _, err := term.GetSize(fd)
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	rows := 0
+	for _, line := range strings.Split(text, "\n") {
+		n := utf8.RuneCountInString(line)
+		rows += 1 + max(n-1, 0)/width
+	}
+	return rows
+}
+
+// clearLines erases the last n rows of output, including the current one,
+// and leaves the cursor where they started.
+func clearLines(n int) {
+	fmt.Print("\r")
+	if n > 1 {
+		fmt.Printf("\x1b[%dA", n-1)
+	}
+	fmt.Print("\x1b[J")
+}
+
+func init() {
+	revealCmd.Flags().Duration("timeout", 10*time.Second, "hide the secret after this long without a key press")
+	revealCmd.Flags().Bool("confirm", false, "reveal a protected secret without asking")
+}
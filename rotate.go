@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// reencryptToCmd is the first phase of rotating your own identity: every
+// secret is decrypted with the old identity and re-encrypted so that the new
+// key can read it too. Once the old key is removed from the recipients file,
+// re-encrypting again drops it from the store.
+var reencryptToCmd = &cobra.Command{
+	Use:   "reencrypt-to",
+	Short: "Re-encrypt all secrets with an old identity to add a new recipient",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		oldKey, _ := cmd.Flags().GetString("old-key")
+		newRecipient, _ := cmd.Flags().GetString("new-recipient")
+		if oldKey == "" || newRecipient == "" {
+			return fmt.Errorf("%w: --old-key and --new-recipient are required", ErrUsage)
+		}
+		// A bad key would be saved for good and fail every write after
+		if err := validateRecipient(newRecipient); err != nil {
+			return fmt.Errorf("%w: --new-recipient: %v", ErrUsage, err)
+		}
+		oldKey = expandHome(oldKey)
+		if _, err := os.Stat(oldKey); err != nil {
+			return fmt.Errorf("reading old identity: %w", err)
+		}
+
+		if recipientsCommand() != "" {
+			// The recipient list is managed elsewhere; it must already
+			// include the new key
+			if !hasRecipient(newRecipient) {
+				return fmt.Errorf("the new recipient is not in the output of the recipients command; add it at the source first")
+			}
+		} else {
+			// Secrets added after this point must include the new key too
+			added, err := appendRecipient(newRecipient, "")
+			if err != nil {
+				return err
+			}
+			if added {
+				printStatus("✓ Added new recipient to %s\n", recipientsFile)
+			}
+		}
+
+		res := reencryptStore(oldKey)
+		for _, name := range res.Skipped {
+			printWarning("✗ %s: %v\n", displayName(name), res.Errors[name])
+		}
+		if err := res.report("reencrypt-to"); err != nil {
+			return err
+		}
+		if len(res.Skipped) > 0 {
+			return fmt.Errorf("%w: %d secrets could not be decrypted with the old key: %s",
+				ErrDecrypt, len(res.Skipped), strings.Join(displayNames(res.Skipped), ", "))
+		}
+		return nil
+	},
+}
+
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey [secret-name...]",
+	Short: "Re-encrypt secrets to the current recipients",
+	Long: `Re-encrypt the named secrets, or every secret if none are given, to the
+current recipients.
+
+With --since-commit, rekey only if the keys in a recipients file changed
+between that git revision and HEAD, e.g. in a post-merge hook:
+
+  secrets rekey --since-commit ORIG_HEAD
+
+With --drop-expired, recipients whose comment has passed its expiry date,
+e.g. "# bob, expires 2025-01-01", are removed from the recipients file
+first (see recipients expired), and the secrets are re-encrypted without
+them.`,
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if since, _ := cmd.Flags().GetString("since-commit"); since != "" {
+			changed, err := recipientsChangedSince(since)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				printStatus("✓ Recipients unchanged since %s; no rekey needed\n", since)
+				return nil
+			}
+			printStatus("Recipients changed since %s; rekeying\n", since)
+		}
+		showChanges, _ := cmd.Flags().GetBool("show-changes")
+		// The recipients --show-changes compares against
+		var target []recipient
+		dropExpired, _ := cmd.Flags().GetBool("drop-expired")
+		if dropExpired {
+			kept, dropped, err := dropExpiredRecipients(showChanges)
+			if err != nil {
+				return err
+			}
+			if dropped == 0 {
+				printStatus("✓ No recipients have expired; no rekey needed\n")
+				return nil
+			}
+			target = kept
+		}
+		names, excluded, err := rekeyTargets(args)
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			printStatus("✓ Nothing to re-encrypt%s\n", excludedNote(excluded))
+			return nil
+		}
+		if showChanges {
+			if !dropExpired {
+				if target, err = effectiveRecipients(); err != nil {
+					return fmt.Errorf("reading recipients: %w", err)
+				}
+			}
+			return showRekeyChanges(names, target)
+		}
+		if dryRun {
+			if err := requireMinRecipients(); err != nil {
+				return err
+			}
+			for _, name := range names {
+				printDryRun("re-encrypt %s", filepath.Join(secretsDir, filepath.FromSlash(name)))
+			}
+			return nil
+		}
+
+		res, err := rekeyStore(rekeyOptions{Names: names})
+		if err != nil {
+			return err
+		}
+		res.Excluded = excluded
+		return res.report("rekey")
+	},
+}
+
+// dropExpiredRecipients removes the expired recipients from the recipients
+// file, so that rekey and later writes leave them out. It returns the
+// recipients that are kept and how many were dropped. With --dry-run, or
+// analyze for --show-changes, the file is left alone and only the result is
+// worked out.
+func dropExpiredRecipients(analyze bool) ([]recipient, int, error) {
+	if recipientsCommand() != "" {
+		return nil, 0, fmt.Errorf("%w: --drop-expired needs a recipients file, not a recipients command", ErrUsage)
+	}
+	recipients, err := effectiveRecipients()
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading recipients: %w", err)
+	}
+	expired := expiredRecipients(recipients, time.Now())
+	if dryRun || analyze {
+		drop := map[string]bool{}
+		for _, r := range expired {
+			printDryRun("remove %s from %s", recipientName(r), recipientsFile)
+			drop[recipientID(r.Key)] = true
+		}
+		var kept []recipient
+		for _, r := range recipients {
+			if !drop[recipientID(r.Key)] {
+				kept = append(kept, r)
+			}
+		}
+		return kept, len(expired), nil
+	}
+	for _, r := range expired {
+		if _, err := removeRecipient(r.Key); err != nil {
+			return nil, 0, err
+		}
+		printStatus("- Removed expired recipient %s\n", recipientName(r))
+	}
+	if recipients, err = effectiveRecipients(); err != nil {
+		return nil, 0, fmt.Errorf("reading recipients: %w", err)
+	}
+	// Keys from other recipients_files are not ours to edit
+	if left := expiredRecipients(recipients, time.Now()); len(left) > 0 {
+		return nil, 0, fmt.Errorf("%d expired recipients are listed in recipients files other than %s; remove them there and rekey", len(left), recipientsFile)
+	}
+	return recipients, len(expired), nil
+}
+
+// recipientsChangedSince reports whether the keys in any recipients file
+// differ between the git revision ref and HEAD of the repository holding
+// it. Edits to comments alone don't count.
+func recipientsChangedSince(ref string) (bool, error) {
+	if recipientsCommand() != "" {
+		return false, fmt.Errorf("%w: --since-commit needs recipients files, not a recipients command", ErrUsage)
+	}
+	for _, f := range recipientsFiles {
+		before, err := gitShow(f, ref)
+		if err != nil {
+			return false, err
+		}
+		after, err := gitShow(f, "HEAD")
+		if err != nil {
+			return false, err
+		}
+		keys := func(data []byte) map[string]bool {
+			set := map[string]bool{}
+			for _, r := range parseRecipients(data) {
+				set[recipientID(r.Key)] = true
+			}
+			return set
+		}
+		if !maps.Equal(keys(before), keys(after)) {
+			printVerbose("%s changed since %s\n", f, ref)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// gitShow returns the content of file at the git revision ref, or nil if
+// it did not exist there.
+func gitShow(file, ref string) ([]byte, error) {
+	cmd := exec.Command("git", "-C", filepath.Dir(file), "show", ref+":./"+filepath.Base(file))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err == nil {
+		return out, nil
+	}
+	// Tell a file missing at ref apart from a bad ref
+	if exec.Command("git", "-C", filepath.Dir(file), "rev-parse", "--verify", "--quiet", ref+"^{commit}").Run() == nil {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("reading %s at %s: %s", file, ref, strings.TrimSpace(stderr.String()))
+}
+
+// bulkResult is the outcome of re-encrypting many secrets. The functions
+// behind the bulk commands return it instead of printing, so they can be
+// called on their own; the commands then report it.
+type bulkResult struct {
+	Processed []string
+	Skipped   []string
+	Failed    []string
+	// Errors holds the reason for each failed or skipped secret
+	Errors map[string]error
+	// Excluded counts the secrets left out by --exclude
+	Excluded int
+}
+
+func (r *bulkResult) fail(name string, err error) {
+	r.Failed = append(r.Failed, name)
+	r.setError(name, err)
+}
+
+func (r *bulkResult) skip(name string, err error) {
+	r.Skipped = append(r.Skipped, name)
+	r.setError(name, err)
+}
+
+func (r *bulkResult) setError(name string, err error) {
+	if r.Errors == nil {
+		r.Errors = map[string]error{}
+	}
+	r.Errors[name] = err
+}
+
+// report prints the outcome, runs the post hook for op on the secrets that
+// changed, and returns an error if any failed.
+func (r bulkResult) report(op string) error {
+	for _, name := range r.Failed {
+		printWarning("✗ %s: %v\n", displayName(name), r.Errors[name])
+	}
+	var notes []string
+	if len(r.Skipped) > 0 {
+		notes = append(notes, fmt.Sprintf("%d skipped", len(r.Skipped)))
+	}
+	if r.Excluded > 0 {
+		notes = append(notes, fmt.Sprintf("%d excluded", r.Excluded))
+	}
+	if len(notes) > 0 {
+		printStatus("✓ Re-encrypted %d secrets (%s)\n", len(r.Processed), strings.Join(notes, ", "))
+	} else {
+		printStatus("✓ Re-encrypted %d secrets\n", len(r.Processed))
+	}
+	if len(r.Processed) > 0 {
+		if err := runHook(op, r.Processed...); err != nil {
+			return err
+		}
+	}
+	if len(r.Failed) > 0 {
+		return fmt.Errorf("%d secrets could not be re-encrypted: %s", len(r.Failed), strings.Join(displayNames(r.Failed), ", "))
+	}
+	return nil
+}
+
+// rekeyOptions selects what rekeyStore works on.
+type rekeyOptions struct {
+	// Names lists the secrets to rekey; all secrets when empty
+	Names []string
+}
+
+// rekeyTargets resolves secret names given on the command line, or returns
+// every secret if there are none, less those matching --exclude. It also
+// returns how many were excluded.
+func rekeyTargets(args []string) ([]string, int, error) {
+	if len(args) == 0 {
+		return excludeSecrets(getSecretNames())
+	}
+	var names []string
+	for _, arg := range args {
+		name, path, err := resolveSecret(arg)
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, 0, fmt.Errorf("%w: %s", ErrSecretNotFound, displayName(name))
+		}
+		names = append(names, name)
+	}
+	return excludeSecrets(names)
+}
+
+// rekeyStore re-encrypts secrets to the current recipients. Secrets
+// protected by a passphrase rather than recipients are skipped.
+func rekeyStore(opts rekeyOptions) (bulkResult, error) {
+	var res bulkResult
+	if err := requireMinRecipients(); err != nil {
+		return res, err
+	}
+	names := opts.Names
+	if len(names) == 0 {
+		names = getSecretNames()
+	}
+	for _, name := range names {
+		stanzas, err := readHeader(filepath.Join(secretsDir, filepath.FromSlash(name)))
+		if err != nil {
+			res.fail(name, err)
+			continue
+		}
+		if recipientStanzas(stanzas) == 0 {
+			res.skip(name, errors.New("encrypted with a passphrase"))
+			continue
+		}
+		if err := rekeySecret(name); err != nil {
+			res.fail(name, err)
+			continue
+		}
+		res.Processed = append(res.Processed, name)
+	}
+	return res, nil
+}
+
+// reencryptStore decrypts every secret with the identity at oldKey and
+// encrypts it to the current recipients. Secrets the old key can't decrypt
+// are skipped.
+func reencryptStore(oldKey string) bulkResult {
+	var res bulkResult
+	for _, name := range getSecretNames() {
+		secretPath := filepath.Join(secretsDir, filepath.FromSlash(name))
+		content, err := decryptSecretWith(secretPath, oldKey)
+		if err != nil {
+			res.skip(name, err)
+			continue
+		}
+		if err := encryptSecret(content, secretPath); err != nil {
+			res.fail(name, err)
+			continue
+		}
+		res.Processed = append(res.Processed, name)
+	}
+	return res
+}
+
+// showRekeyChanges prints, for each of names, how rekeying to recipients
+// would change who it is encrypted to, without writing anything.
+func showRekeyChanges(names []string, recipients []recipient) error {
+	history, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	changed := 0
+	for _, name := range names {
+		stanzas, err := readHeader(filepath.Join(secretsDir, filepath.FromSlash(name)))
+		if err != nil {
+			printWarning("✗ %s: %v\n", displayName(name), err)
+			continue
+		}
+		d := diffRecipients(stanzas, recipients, history)
+		if d.empty() {
+			continue
+		}
+		changed++
+		fmt.Printf("%s:\n", displayName(name))
+		for _, who := range d.Missing {
+			fmt.Printf("  + %s\n", who)
+		}
+		for _, who := range d.Removed {
+			fmt.Printf("  - %s\n", who)
+		}
+		if d.Opaque != d.WantOpaque {
+			fmt.Printf("  ~ X25519/plugin recipients: %d -> %d\n", d.Opaque, d.WantOpaque)
+		}
+	}
+	fmt.Printf("%d of %d secrets would change\n", changed, len(names))
+	return nil
+}
+
+var reencryptCmd = &cobra.Command{
+	Use:   "reencrypt [secret-name]",
+	Short: "Print a secret encrypted to other recipients, without storing it",
+	Long: `Decrypt a secret and encrypt it again to the --recipient keys only, writing
+the age file to stdout or --output, e.g. to send it to someone:
+
+  secrets reencrypt prod/db --recipient age1... --armor | mail ...
+
+The store is not changed.`,
+	Args:              usageArgs(cobra.ExactArgs(1)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys, _ := cmd.Flags().GetStringArray("recipient")
+		armor, _ := cmd.Flags().GetBool("armor")
+		output, _ := cmd.Flags().GetString("output")
+		if len(keys) == 0 {
+			return fmt.Errorf("%w: at least one --recipient is required", ErrUsage)
+		}
+		for _, key := range keys {
+			if err := validateRecipient(key); err != nil {
+				return err
+			}
+		}
+		if output == "" && !armor && isTerminal(os.Stdout) {
+			return fmt.Errorf("%w: refusing to write binary ciphertext to a terminal; pass --armor or redirect it", ErrUsage)
+		}
+
+		secretName, secretPath, err := resolveSecret(args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(secretPath); os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrSecretNotFound, displayName(secretName))
+		}
+		content, err := decryptSecret(secretPath)
+		if err != nil {
+			return fmt.Errorf("decrypting secret: %w", err)
+		}
+		recordAudit("reencrypt", secretName)
+
+		var buf bytes.Buffer
+		if err := encryptFor(&buf, content, keys, armor); err != nil {
+			return fmt.Errorf("encrypting secret: %w", err)
+		}
+		if output != "" {
+			return writeRendered([]renderedFile{{path: output, data: buf.Bytes()}})
+		}
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	},
+}
+
+func init() {
+	rekeyCmd.Flags().Bool("show-changes", false, "print how each secret's recipients would change, without rekeying")
+	rekeyCmd.Flags().Bool("drop-expired", false, "first remove recipients whose \"expires YYYY-MM-DD\" comment date has passed")
+	rekeyCmd.Flags().String("since-commit", "", "rekey only if the keys of a recipients file changed between this git revision and HEAD")
+	reencryptToCmd.Flags().String("old-key", "", "identity file able to decrypt the current secrets")
+	reencryptToCmd.Flags().String("new-recipient", "", "public key to add to every secret")
+	reencryptCmd.Flags().StringArrayP("recipient", "r", nil, "public key to encrypt to (repeatable)")
+	reencryptCmd.Flags().BoolP("armor", "a", false, "write ASCII-armored output")
+	reencryptCmd.Flags().StringP("output", "o", "", "write the age file here with 0600 permissions instead of stdout")
+}
+
+// rekeySecret decrypts a secret with the default identity and encrypts it
+// again to the current recipients.
+func rekeySecret(name string) error {
+	secretPath := filepath.Join(secretsDir, filepath.FromSlash(name))
+	content, err := decryptSecret(secretPath)
+	if err != nil {
+		return fmt.Errorf("decrypting secret: %w", err)
+	}
+	if err := encryptSecret(content, secretPath); err != nil {
+		return fmt.Errorf("encrypting secret: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestRekeyDropExpiredShowChangesWritesNothing(t *testing.T) {
+	id := useTestStore(t)
+	testSecret(t, "prod/db", []byte("hunter2\n"))
+	expired, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), ".age-recipients")
+	data := []byte(fmt.Sprintf("# me\n%s\n# contractor, expires 2001-01-01\n%s\n", id.Recipient(), expired.Recipient()))
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldFile, oldFiles := recipientsFile, recipientsFiles
+	recipientsFile, recipientsFiles = file, []string{file}
+	defer func() { recipientsFile, recipientsFiles = oldFile, oldFiles }()
+	for _, flag := range []string{"drop-expired", "show-changes"} {
+		if err := rekeyCmd.Flags().Set(flag, "true"); err != nil {
+			t.Fatal(err)
+		}
+		defer rekeyCmd.Flags().Set(flag, "false")
+	}
+
+	out := captureStdout(t, func() error {
+		return rekeyCmd.RunE(rekeyCmd, nil)
+	})
+	after, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after, data) {
+		t.Errorf("rekey --drop-expired --show-changes changed the recipients file to %q", after)
+	}
+	if !strings.Contains(string(out), "0 of 1 secrets would change") {
+		t.Errorf("output = %q, want the secret, encrypted without the expired key, unchanged", out)
+	}
+}
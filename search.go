@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search [pattern]",
+	Short: "List the secrets whose value matches a regular expression",
+	Long: `Decrypt every secret and list the names of those with a line matching the
+regular expression pattern. The matching lines themselves are never shown.
+--count prints only the number of matching secrets, and --count-matches
+the number of matching lines across them all.`,
+	Args: usageArgs(cobra.ExactArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		count, _ := cmd.Flags().GetBool("count")
+		countMatches, _ := cmd.Flags().GetBool("count-matches")
+		ignoreCase, _ := cmd.Flags().GetBool("ignore-case")
+		if count && countMatches {
+			return fmt.Errorf("%w: --count and --count-matches cannot be combined", ErrUsage)
+		}
+		pattern := args[0]
+		if ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%w: invalid pattern: %v", ErrUsage, err)
+		}
+
+		var matched, failed []string
+		lines := 0
+		for _, name := range getSecretNames() {
+			content, err := decryptSecret(filepath.Join(secretsDir, filepath.FromSlash(name)))
+			if err != nil {
+				printWarning("✗ %s: %v\n", displayName(name), err)
+				failed = append(failed, name)
+				continue
+			}
+			n := 0
+			if !isBinary(content) {
+				for _, line := range strings.Split(content, "\n") {
+					if re.MatchString(line) {
+						n++
+					}
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			recordAudit("search", name)
+			matched = append(matched, name)
+			lines += n
+			if !count && !countMatches {
+				fmt.Println(displayName(name))
+			}
+		}
+		switch {
+		case count:
+			fmt.Println(len(matched))
+		case countMatches:
+			fmt.Println(lines)
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%d secrets could not be searched: %s", len(failed), strings.Join(displayNames(failed), ", "))
+		}
+		return nil
+	},
+}
+
+func init() {
+	searchCmd.Flags().Bool("count", false, "print only the number of matching secrets")
+	searchCmd.Flags().Bool("count-matches", false, "print only the number of matching lines across all secrets")
+	searchCmd.Flags().BoolP("ignore-case", "i", false, "match without regard to case")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseRange parses "M:N", "M:" or ":N". Missing bounds are returned as -1.
+func parseRange(s string) (int, int, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("%w: invalid range %q, expected start:end", ErrUsage, s)
+	}
+	bounds := [2]int{-1, -1}
+	for i, p := range parts {
+		if p == "" {
+			continue
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("%w: invalid range %q, bounds must be non-negative integers", ErrUsage, s)
+		}
+		bounds[i] = n
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// selectLines returns lines start through end of content, 1-based and
+// inclusive, each terminated by a newline. end == -1 means the last line.
+func selectLines(content string, start, end int) (string, error) {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if start == -1 {
+		start = 1
+	}
+	if end == -1 {
+		end = len(lines)
+	}
+	if start < 1 || start > end {
+		return "", fmt.Errorf("%w: invalid line range %d:%d", ErrUsage, start, end)
+	}
+	if end > len(lines) {
+		return "", fmt.Errorf("line %d out of range: secret has %d lines", end, len(lines))
+	}
+	return strings.Join(lines[start-1:end], "\n") + "\n", nil
+}
+
+// selectBytes returns content[start:end]. end == -1 means the end of content.
+func selectBytes(content string, start, end int) (string, error) {
+	if start == -1 {
+		start = 0
+	}
+	if end == -1 {
+		end = len(content)
+	}
+	if start > end {
+		return "", fmt.Errorf("%w: invalid byte range %d:%d", ErrUsage, start, end)
+	}
+	if end > len(content) {
+		return "", fmt.Errorf("byte %d out of range: secret is %d bytes", end, len(content))
+	}
+	return content[start:end], nil
+}
+
+// selection is a parsed --line, --lines or --bytes request. A zero value
+// selects the whole content.
+type selection struct {
+	byLine     bool
+	byByte     bool
+	start, end int
+}
+
+// parseSelection validates the slicing flags of get before anything is
+// decrypted. At most one of them may be set.
+func parseSelection(line int, lines, byteRange string) (selection, error) {
+	set := 0
+	for _, ok := range []bool{line != 0, lines != "", byteRange != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return selection{}, fmt.Errorf("%w: --line, --lines and --bytes are mutually exclusive", ErrUsage)
+	}
+
+	switch {
+	case line != 0:
+		if line < 0 {
+			return selection{}, fmt.Errorf("%w: --line must be positive", ErrUsage)
+		}
+		return selection{byLine: true, start: line, end: line}, nil
+	case lines != "":
+		start, end, err := parseRange(lines)
+		return selection{byLine: true, start: start, end: end}, err
+	case byteRange != "":
+		start, end, err := parseRange(byteRange)
+		return selection{byByte: true, start: start, end: end}, err
+	}
+	return selection{}, nil
+}
+
+func (s selection) apply(content string) (string, error) {
+	switch {
+	case s.byLine:
+		return selectLines(content, s.start, s.end)
+	case s.byByte:
+		return selectBytes(content, s.start, s.end)
+	}
+	return content, nil
+}
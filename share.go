@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var shareCmd = &cobra.Command{
+	Use:   "share [secret-name]",
+	Short: "Split a secret into shares, any --threshold of which recover it",
+	Long: `Split the value of a secret into --shares pieces with Shamir's secret
+sharing, so that any --threshold of them recover it and fewer reveal
+nothing. Each share is encrypted to one holder, in the order of the
+recipients file, or of --holders, a file in the same format. The shares are
+written to --output-dir as name.shareN.age, each for its holder to keep;
+recover puts the value back together.`,
+	Args:              usageArgs(cobra.ExactArgs(1)),
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		threshold, _ := cmd.Flags().GetInt("threshold")
+		shares, _ := cmd.Flags().GetInt("shares")
+		holdersFile, _ := cmd.Flags().GetString("holders")
+		outDir, _ := cmd.Flags().GetString("output-dir")
+
+		var holders []recipient
+		var err error
+		if holdersFile != "" {
+			holders, err = loadRecipients(holdersFile)
+		} else {
+			holders, err = effectiveRecipients()
+		}
+		if err != nil {
+			return fmt.Errorf("reading share holders: %w", err)
+		}
+		if !cmd.Flags().Changed("shares") {
+			shares = len(holders)
+		}
+		switch {
+		case shares != len(holders):
+			return fmt.Errorf("%w: %d shares need %d holders, but %d are listed", ErrUsage, shares, shares, len(holders))
+		case shares > 255:
+			return fmt.Errorf("%w: at most 255 shares are possible", ErrUsage)
+		case threshold < 2 || threshold > shares:
+			return fmt.Errorf("%w: --threshold must be between 2 and the number of shares, %d", ErrUsage, shares)
+		}
+		for _, h := range holders {
+			if err := validateRecipient(h.Key); err != nil {
+				return err
+			}
+		}
+
+		secretName, secretPath, err := resolveSecret(args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(secretPath); os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrSecretNotFound, displayName(secretName))
+		}
+		value, err := decryptSecret(secretPath)
+		if err != nil {
+			return fmt.Errorf("decrypting secret: %w", err)
+		}
+		parts, err := shamirSplit([]byte(value), shares, threshold)
+		if err != nil {
+			return err
+		}
+		recordAudit("share", secretName)
+
+		if err := os.MkdirAll(outDir, 0700); err != nil {
+			return fmt.Errorf("creating %s: %w", outDir, err)
+		}
+		base := strings.ReplaceAll(displayName(secretName), "/", "_")
+		for i, part := range parts {
+			text := fmt.Sprintf("# Share %d of %d of the secret %s; %d are needed to recover it\nsecret: %s\nthreshold: %d\nshare: %s\n",
+				i+1, shares, displayName(secretName), threshold, secretName, threshold, base64.StdEncoding.EncodeToString(part))
+			path := filepath.Join(outDir, fmt.Sprintf("%s.share%d.age", base, i+1))
+			var buf bytes.Buffer
+			if err := encryptFor(&buf, text, []string{holders[i].Key}, true); err != nil {
+				return fmt.Errorf("encrypting share %d: %w", i+1, err)
+			}
+			if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+				return err
+			}
+			printStatus("✓ %s for %s\n", path, recipientName(holders[i]))
+		}
+		printStatus("✓ Split '%s' into %d shares, %d needed to recover it\n", displayName(secretName), shares, threshold)
+		return nil
+	},
+}
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover [share-file...]",
+	Short: "Put a secret split by share back together",
+	Long: `Combine shares written by share and print the value. A share file may be
+still encrypted, in which case it is decrypted with the identity (use
+--decrypt-with for several), or already decrypted by its holder.`,
+	Args: usageArgs(cobra.MinimumNArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var name string
+		var threshold int
+		var parts [][]byte
+		for _, file := range args {
+			s, err := readShare(file)
+			if err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			if name == "" {
+				name, threshold = s.secret, s.threshold
+			} else if s.secret != name || s.threshold != threshold {
+				return fmt.Errorf("%w: %s is a share of %s, not of %s", ErrUsage, file, displayName(s.secret), displayName(name))
+			}
+			parts = append(parts, s.part)
+		}
+		if len(parts) < threshold {
+			return fmt.Errorf("%w: %s needs %d shares, but only %d were given", ErrUsage, displayName(name), threshold, len(parts))
+		}
+		value, err := shamirCombine(parts)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(value)
+		return err
+	},
+}
+
+// shareFile is the content of a share written by share.
+type shareFile struct {
+	secret    string
+	threshold int
+	part      []byte
+}
+
+func readShare(path string) (shareFile, error) {
+	var s shareFile
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	text := string(data)
+	if looksEncrypted(text) {
+		if text, err = decryptSecret(path); err != nil {
+			return s, err
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		switch key {
+		case "secret":
+			s.secret = value
+		case "threshold":
+			s.threshold, err = strconv.Atoi(value)
+		case "share":
+			s.part, err = base64.StdEncoding.DecodeString(value)
+		}
+		if err != nil {
+			return s, fmt.Errorf("malformed %s line: %w", key, err)
+		}
+	}
+	if s.secret == "" || s.threshold < 2 || len(s.part) < 2 {
+		return s, errors.New("not a share written by secrets share")
+	}
+	return s, nil
+}
+
+// shamirSplit splits secret into n shares any k of which recover it, over
+// GF(2^8) one byte at a time. A share holds the values of the polynomials
+// at one point followed by that point, the layout of hashicorp/vault/shamir,
+// so its Combine reads these shares too.
+func shamirSplit(secret []byte, n, k int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("cannot split an empty secret")
+	}
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+	coeffs := make([]byte, k)
+	for b, c := range secret {
+		coeffs[0] = c
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			shares[i][b] = gfEval(coeffs, byte(i+1))
+		}
+	}
+	return shares, nil
+}
+
+// shamirCombine recovers the secret from shares made by shamirSplit by
+// interpolating the polynomials at zero.
+func shamirCombine(shares [][]byte) ([]byte, error) {
+	size := len(shares[0])
+	xs := make([]byte, len(shares))
+	seen := map[byte]bool{}
+	for i, s := range shares {
+		if len(s) != size {
+			return nil, errors.New("shares differ in length")
+		}
+		xs[i] = s[size-1]
+		if xs[i] == 0 || seen[xs[i]] {
+			return nil, errors.New("the same share was given twice")
+		}
+		seen[xs[i]] = true
+	}
+	secret := make([]byte, size-1)
+	for i, s := range shares {
+		// Lagrange basis at zero: the product of x_j / (x_j - x_i), where
+		// subtraction is xor
+		basis := byte(1)
+		for j := range shares {
+			if j != i {
+				basis = gfMul(basis, gfMul(xs[j], gfInv(xs[j]^xs[i])))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= gfMul(s[b], basis)
+		}
+	}
+	return secret, nil
+}
+
+// gfEval evaluates the polynomial with the given coefficients, lowest
+// first, at x.
+func gfEval(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// gfMul multiplies in GF(2^8) with the AES polynomial, without tables.
+func gfMul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= a & -(b & 1)
+		carry := a >> 7
+		a = a<<1 ^ 0x1b&-carry
+		b >>= 1
+	}
+	return p
+}
+
+// gfInv returns the multiplicative inverse of a non-zero a, a^254.
+func gfInv(a byte) byte {
+	r := a
+	for i := 0; i < 6; i++ {
+		r = gfMul(gfMul(r, r), a)
+	}
+	return gfMul(r, r)
+}
+
+func init() {
+	shareCmd.Flags().IntP("threshold", "k", 2, "number of shares needed to recover the secret")
+	shareCmd.Flags().IntP("shares", "n", 0, "number of shares, one per holder (default the number of holders)")
+	shareCmd.Flags().String("holders", "", "recipients-format file of the share holders (default the recipients)")
+	shareCmd.Flags().StringP("output-dir", "o", ".", "directory to write the share files to")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A secret can have a sidecar, name.age.recipients, listing the recipients
+// it was last encrypted to with their comments from the recipients file.
+// age headers don't record X25519 keys, so the sidecar is what lets info
+// and status say who can read such a secret. Writing one is opt-in; once a
+// secret has one, every re-encryption keeps it current.
+const sidecarSuffix = ".recipients"
+
+// recordRecipientsFlag is bound to --record-recipients on add and edit.
+var recordRecipientsFlag bool
+
+func sidecarPath(secretPath string) string {
+	return secretPath + sidecarSuffix
+}
+
+// recordsRecipients reports whether encrypting to secretPath should write
+// its sidecar.
+func recordsRecipients(secretPath string) bool {
+	if recordRecipientsFlag || cfg.RecordRecipients {
+		return true
+	}
+	_, err := os.Stat(sidecarPath(secretPath))
+	return err == nil
+}
+
+// writeSidecar records recipients as the ones secretPath is encrypted to,
+// in the recipients file format.
+func writeSidecar(secretPath string, recipients []recipient) error {
+	var b strings.Builder
+	b.WriteString("# Recipients this secret is encrypted to, kept by secrets\n")
+	for _, r := range recipients {
+		b.WriteString("\n")
+		if r.Comment != "" {
+			fmt.Fprintf(&b, "# %s\n", r.Comment)
+		}
+		b.WriteString(r.Key + "\n")
+	}
+	return writeSecretFile(sidecarPath(secretPath), []byte(b.String()))
+}
+
+// removeSidecar drops the sidecar of secretPath, for when the recipients
+// it would list are unknown.
+func removeSidecar(secretPath string) {
+	os.Remove(sidecarPath(secretPath))
+}
+
+// loadSidecar returns the recorded recipients of secretPath. ok is false if
+// there is no sidecar or it doesn't match the stanzas of the secret, which
+// means it is out of date.
+func loadSidecar(secretPath string, stanzas []stanza) ([]recipient, bool) {
+	recorded, err := loadRecipients(sidecarPath(secretPath))
+	if err != nil || len(recorded) == 0 || len(recorded) != recipientStanzas(stanzas) {
+		return nil, false
+	}
+	return recorded, true
+}
+
+// diffRecorded compares the recorded recipients of a secret with the
+// current ones key by key, which works for every kind of recipient.
+func diffRecorded(recorded, recipients []recipient) recipientDiff {
+	var d recipientDiff
+	had := map[string]bool{}
+	for _, r := range recorded {
+		had[recipientID(r.Key)] = true
+	}
+	want := map[string]bool{}
+	for _, r := range recipients {
+		want[recipientID(r.Key)] = true
+		if !had[recipientID(r.Key)] {
+			d.Missing = append(d.Missing, recipientName(r))
+		}
+	}
+	for _, r := range recorded {
+		if !want[recipientID(r.Key)] {
+			d.Removed = append(d.Removed, recipientName(r))
+		}
+	}
+	return d
+}
+
+// recipientName is the comment of r, or its shortened key if it has none.
+func recipientName(r recipient) string {
+	if r.Comment != "" {
+		return r.Comment
+	}
+	return truncateKey(r.Key)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// storeStats is the result of the stats command. It doubles as its --json
+// output.
+type storeStats struct {
+	Secrets           int          `json:"secrets"`
+	TotalBytes        int64        `json:"total_bytes"`
+	Oldest            *datedSecret `json:"oldest,omitempty"`
+	Newest            *datedSecret `json:"newest,omitempty"`
+	CurrentRecipients int          `json:"current_recipients"`
+	// DistinctRecipients counts the recipients identifiable from the
+	// headers and sidecars across the store
+	DistinctRecipients int            `json:"distinct_recipients"`
+	ByRecipient        map[string]int `json:"by_recipient"`
+	Unattributed       int            `json:"unattributed_stanzas"`
+	NeedsRekey         []rekeyNeed    `json:"needs_rekey"`
+	Unreadable         []string       `json:"unreadable"`
+}
+
+type datedSecret struct {
+	Name     string    `json:"name"`
+	Modified time.Time `json:"modified"`
+}
+
+type rekeyNeed struct {
+	Name       string `json:"name"`
+	Recipients int    `json:"recipients"`
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarize the store",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		st, err := collectStats()
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(st)
+		}
+		printStats(st)
+		return nil
+	},
+}
+
+func collectStats() (storeStats, error) {
+	st := storeStats{ByRecipient: map[string]int{}, NeedsRekey: []rekeyNeed{}, Unreadable: []string{}}
+	recipients, err := effectiveRecipients()
+	if err != nil {
+		return st, fmt.Errorf("reading recipients: %w", err)
+	}
+	st.CurrentRecipients = len(recipients)
+
+	distinct := map[string]bool{}
+	headers := loadHeaderCache()
+	defer headers.save()
+	for _, name := range getSecretNames() {
+		path := filepath.Join(secretsDir, filepath.FromSlash(name))
+		info, err := os.Stat(path)
+		if err != nil {
+			st.Unreadable = append(st.Unreadable, displayName(name))
+			continue
+		}
+		st.Secrets++
+		st.TotalBytes += info.Size()
+		if st.Oldest == nil || info.ModTime().Before(st.Oldest.Modified) {
+			st.Oldest = &datedSecret{displayName(name), info.ModTime()}
+		}
+		if st.Newest == nil || info.ModTime().After(st.Newest.Modified) {
+			st.Newest = &datedSecret{displayName(name), info.ModTime()}
+		}
+
+		stanzas, err := headers.readHeader(path)
+		if err != nil {
+			st.Unreadable = append(st.Unreadable, displayName(name))
+			continue
+		}
+		for _, s := range stanzas {
+			if who, ok := identifyStanza(s, recipients); ok {
+				st.ByRecipient[who]++
+			} else {
+				st.Unattributed++
+			}
+		}
+		if recorded, ok := loadSidecar(path, stanzas); ok {
+			for _, r := range recorded {
+				distinct[storeRecipientID(r.Key)] = true
+			}
+		} else {
+			for _, s := range stanzas {
+				if (s.Type == "ssh-ed25519" || s.Type == "ssh-rsa") && len(s.Args) > 0 {
+					distinct["ssh:"+s.Args[0]] = true
+				}
+			}
+		}
+		// Passphrase secrets have no recipients to fall behind on
+		n := recipientStanzas(stanzas)
+		if n > 0 && n < len(recipients) {
+			st.NeedsRekey = append(st.NeedsRekey, rekeyNeed{displayName(name), n})
+		}
+	}
+	st.DistinctRecipients = len(distinct)
+	return st, nil
+}
+
+// storeRecipientID identifies a recorded recipient key the way an SSH
+// stanza identifies its key, by tag, so that both count once.
+func storeRecipientID(key string) string {
+	if recipientType(key) == "ssh" {
+		return "ssh:" + sshTag(key)
+	}
+	return recipientID(key)
+}
+
+func printStats(st storeStats) {
+	fmt.Printf("Secrets:     %d\n", st.Secrets)
+	fmt.Printf("Total size:  %d bytes\n", st.TotalBytes)
+	if st.Oldest != nil {
+		fmt.Printf("Oldest:      %s (%s)\n", st.Oldest.Name, st.Oldest.Modified.Format("2006-01-02"))
+		fmt.Printf("Newest:      %s (%s)\n", st.Newest.Name, st.Newest.Modified.Format("2006-01-02"))
+	}
+	fmt.Printf("Recipients:  %d current, %d distinct identifiable in the store\n", st.CurrentRecipients, st.DistinctRecipients)
+
+	if len(st.ByRecipient) > 0 {
+		fmt.Println("\nSecrets per identifiable recipient:")
+		var who []string
+		for w := range st.ByRecipient {
+			who = append(who, w)
+		}
+		sort.Strings(who)
+		for _, w := range who {
+			fmt.Printf("  %-40s %d\n", w, st.ByRecipient[w])
+		}
+	}
+	if st.Unattributed > 0 {
+		fmt.Printf("\n%d X25519 or plugin stanzas can't be attributed to a recipient from the header.\n", st.Unattributed)
+	}
+	if len(st.NeedsRekey) > 0 {
+		fmt.Printf("\nEncrypted to fewer than the %d current recipients (needs rekey):\n", st.CurrentRecipients)
+		for _, n := range st.NeedsRekey {
+			fmt.Printf("  %s (%d)\n", n.Name, n.Recipients)
+		}
+	}
+	if len(st.Unreadable) > 0 {
+		fmt.Println("\nCould not read:")
+		for _, name := range st.Unreadable {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+}
+
+func init() {
+	statsCmd.Flags().Bool("json", false, "print the summary as JSON")
+	statsCmd.Flags().BoolVar(&noCacheFlag, "no-cache", false, "parse every header again instead of using the header cache")
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List secrets whose recipients differ from the current recipients",
+	Long: `List secrets whose recipients differ from the current recipients.
+
+SSH recipients are matched exactly using the key tag in the age header.
+X25519 and plugin headers do not record which key they were made for, so
+for those only the number of recipients can be compared, unless the secret
+has a .recipients sidecar from --record-recipients. Secrets encrypted
+to fewer recipients than the min_recipients setting are listed as well.`,
+	Args: usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fix, _ := cmd.Flags().GetBool("fix")
+
+		recipients, err := effectiveRecipients()
+		if err != nil {
+			return fmt.Errorf("reading recipients: %w", err)
+		}
+		history, err := loadHistory()
+		if err != nil {
+			return err
+		}
+
+		names, excluded, err := excludeSecrets(getSecretNames())
+		if err != nil {
+			return err
+		}
+		headers := loadHeaderCache()
+		var drifted []string
+		for _, name := range names {
+			reasons, err := driftReasons(name, recipients, history, headers)
+			if err != nil {
+				printWarning("✗ %s: %v\n", displayName(name), err)
+				continue
+			}
+			if len(reasons) == 0 {
+				continue
+			}
+			drifted = append(drifted, name)
+			fmt.Printf("%s: %s\n", displayName(name), strings.Join(reasons, "; "))
+		}
+		headers.save()
+
+		if len(drifted) == 0 {
+			printStatus("✓ All secrets match the current recipients%s\n", excludedNote(excluded))
+			return nil
+		}
+		if !fix {
+			return fmt.Errorf("%d secrets need rekey%s", len(drifted), excludedNote(excluded))
+		}
+		if dryRun {
+			if err := requireMinRecipients(); err != nil {
+				return err
+			}
+			for _, name := range drifted {
+				printDryRun("re-encrypt %s", filepath.Join(secretsDir, filepath.FromSlash(name)))
+			}
+			return nil
+		}
+
+		res, err := rekeyStore(rekeyOptions{Names: drifted})
+		if err != nil {
+			return err
+		}
+		res.Excluded = excluded
+		return res.report("rekey")
+	},
+}
+
+// recipientDiff is how the recipients of a secret differ from the current
+// ones. SSH keys are compared individually; X25519 and plugin stanzas can
+// only be counted.
+type recipientDiff struct {
+	// Missing names the current SSH recipients the secret isn't
+	// encrypted to
+	Missing []string
+	// Removed describes the SSH keys the secret is encrypted to that are
+	// no longer recipients, named from the recipients history if possible
+	Removed []string
+	// Opaque and WantOpaque count X25519 and plugin stanzas in the header
+	// and recipients, respectively
+	Opaque, WantOpaque int
+}
+
+// diffRecipients compares a secret's stanzas with recipients. history, the
+// parsed recipients_history file, is used to name keys that were removed.
+func diffRecipients(stanzas []stanza, recipients, history []recipient) recipientDiff {
+	var d recipientDiff
+	tags := map[string]bool{}
+	for _, s := range stanzas {
+		switch s.Type {
+		case "ssh-ed25519", "ssh-rsa":
+			if len(s.Args) > 0 {
+				tags[s.Args[0]] = true
+			}
+		case "scrypt":
+			// Passphrase secrets aren't encrypted to recipients at all
+			return recipientDiff{}
+		default:
+			d.Opaque++
+		}
+	}
+
+	for _, r := range recipients {
+		tag := sshTag(r.Key)
+		if tag == "" {
+			d.WantOpaque++
+			continue
+		}
+		if tags[tag] {
+			delete(tags, tag)
+			continue
+		}
+		who := r.Comment
+		if who == "" {
+			who = truncateKey(r.Key)
+		}
+		d.Missing = append(d.Missing, who)
+	}
+	for tag := range tags {
+		d.Removed = append(d.Removed, formerRecipient(tag, history))
+	}
+	sort.Strings(d.Removed)
+	return d
+}
+
+// formerRecipient names the SSH key with the given tag from history, falling
+// back to the tag itself.
+func formerRecipient(tag string, history []recipient) string {
+	for _, r := range history {
+		if sshTag(r.Key) != tag {
+			continue
+		}
+		if r.Comment != "" {
+			return r.Comment
+		}
+		return truncateKey(r.Key)
+	}
+	return "SSH key with tag " + tag
+}
+
+// loadHistory reads the recipients_history file, if one is configured.
+func loadHistory() ([]recipient, error) {
+	if cfg.RecipientsHistory == "" {
+		return nil, nil
+	}
+	history, err := loadRecipients(expandHome(cfg.RecipientsHistory))
+	if err != nil {
+		return nil, fmt.Errorf("reading recipients history: %w", err)
+	}
+	return history, nil
+}
+
+func (d recipientDiff) empty() bool {
+	return len(d.Missing) == 0 && len(d.Removed) == 0 && d.Opaque == d.WantOpaque
+}
+
+// reasons explains the difference for status.
+func (d recipientDiff) reasons() []string {
+	var reasons []string
+	for _, who := range d.Missing {
+		reasons = append(reasons, "missing "+who)
+	}
+	for _, who := range d.Removed {
+		reasons = append(reasons, "encrypted to removed recipient "+who)
+	}
+	switch {
+	case d.Opaque < d.WantOpaque:
+		reasons = append(reasons, fmt.Sprintf("%d of %d X25519/plugin recipients", d.Opaque, d.WantOpaque))
+	case d.Opaque > d.WantOpaque:
+		reasons = append(reasons, fmt.Sprintf("%d X25519/plugin recipients, expected %d (removed recipients may still have access)", d.Opaque, d.WantOpaque))
+	}
+	return reasons
+}
+
+// driftReasons explains how the recipients of secret name differ from the
+// current ones, or why they fall short of min_recipients; none means the
+// secret is up to date.
+func driftReasons(name string, recipients, history []recipient, headers *headerCache) ([]string, error) {
+	path := filepath.Join(secretsDir, filepath.FromSlash(name))
+	stanzas, err := headers.readHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	diff := diffRecipients(stanzas, recipients, history)
+	if recorded, ok := loadSidecar(path, stanzas); ok {
+		diff = diffRecorded(recorded, recipients)
+	}
+	reasons := diff.reasons()
+	if n := recipientStanzas(stanzas); cfg.MinRecipients > 0 && n > 0 && n < cfg.MinRecipients {
+		reasons = append(reasons, fmt.Sprintf("encrypted to %d recipients, min_recipients is %d", n, cfg.MinRecipients))
+	}
+	return reasons, nil
+}
+
+// warnDrift prints a one-line summary of the secrets other than except
+// whose recipients have drifted, for add --check-drift and rekey_on_add.
+func warnDrift(except string) {
+	recipients, err := effectiveRecipients()
+	if err != nil {
+		return
+	}
+	history, err := loadHistory()
+	if err != nil {
+		return
+	}
+	headers := loadHeaderCache()
+	defer headers.save()
+	drifted := 0
+	for _, name := range getSecretNames() {
+		if name == except {
+			continue
+		}
+		if reasons, err := driftReasons(name, recipients, history, headers); err == nil && len(reasons) > 0 {
+			drifted++
+		}
+	}
+	if drifted > 0 {
+		printWarning("Warning: %d other secrets differ from the current recipients; see secrets status\n", drifted)
+	}
+}
+
+// recipientStanzas counts the stanzas that are for recipients rather than a
+// passphrase.
+func recipientStanzas(stanzas []stanza) int {
+	n := 0
+	for _, s := range stanzas {
+		if s.Type != "scrypt" {
+			n++
+		}
+	}
+	return n
+}
+
+func init() {
+	statusCmd.Flags().BoolVar(&noCacheFlag, "no-cache", false, "parse every header again instead of using the header cache")
+	statusCmd.Flags().Bool("fix", false, "re-encrypt the drifted secrets to the current recipients")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// extractYAMLKey returns the value at key, a path in the same syntax as
+// --jsonpath, in the YAML document content. Strings are returned as is and
+// anything else as YAML.
+func extractYAMLKey(content, key string) (string, error) {
+	segments, err := parseJSONPath(key)
+	if err != nil {
+		return "", err
+	}
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(content), &v); err != nil {
+		return "", fmt.Errorf("secret is not valid YAML: %w", err)
+	}
+	if v, err = walkPath(v, key, segments); err != nil {
+		return "", err
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// extractTOMLKey returns the value at key in the TOML document content.
+// Strings and dates are returned as is, tables as TOML, and arrays and
+// other values in their JSON form, which for those is valid TOML too.
+func extractTOMLKey(content, key string) (string, error) {
+	segments, err := parseJSONPath(key)
+	if err != nil {
+		return "", err
+	}
+	var doc map[string]interface{}
+	if _, err := toml.Decode(content, &doc); err != nil {
+		return "", fmt.Errorf("secret is not valid TOML: %w", err)
+	}
+	v, err := walkPath(doc, key, segments)
+	if err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case map[string]interface{}:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	}
+	return encodeJSON(v)
+}
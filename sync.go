@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// syncStateFile records, inside the secrets directory, the hash of every
+// file as of the last rclone sync. Comparing both sides against it tells a
+// change on one side from a conflict.
+const syncStateFile = ".sync-state"
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Push or pull the secrets directory to a remote",
+	Long: `Push or pull the secrets directory to the sync_remote from the config,
+using rclone or, with sync_tool set to "git", git. The files are encrypted,
+so any transport is fine.
+
+With rclone, a file changed on both sides since the last sync is a conflict
+and nothing is transferred unless --force is given, in which case the side
+being synced from wins. push also refuses to undo changes made on the remote
+since the last sync; pull them first.`,
+}
+
+var syncPushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Upload local changes to the remote",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+		if syncTool() == "git" {
+			return gitPush(force)
+		}
+		return rcloneSync(true, force)
+	},
+}
+
+var syncPullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Download remote changes",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+		if syncTool() == "git" {
+			return gitPull(force)
+		}
+		return rcloneSync(false, force)
+	},
+}
+
+func syncTool() string {
+	if cfg.SyncTool == "" {
+		return "rclone"
+	}
+	return cfg.SyncTool
+}
+
+// rcloneSync makes the remote match local files (push) or the other way
+// around (pull), leaving alone changes that only the destination side has
+// made unless force is set.
+func rcloneSync(push, force bool) error {
+	remote := strings.TrimSuffix(cfg.SyncRemote, "/")
+	if remote == "" {
+		return fmt.Errorf("%w: set sync_remote in the config, e.g. \"myremote:secrets\"", ErrUsage)
+	}
+
+	base, err := loadSyncState()
+	if err != nil {
+		return err
+	}
+	local, err := localHashes()
+	if err != nil {
+		return err
+	}
+	remoteFiles, err := remoteHashes(remote)
+	if err != nil {
+		return err
+	}
+
+	paths := map[string]bool{}
+	for _, m := range []map[string]string{base, local, remoteFiles} {
+		for p := range m {
+			paths[p] = true
+		}
+	}
+	var transfer, blocked []string
+	for p := range paths {
+		l, r, b := local[p], remoteFiles[p], base[p]
+		switch {
+		case l == r, !push && r == b:
+			// In sync, or a local change that pull leaves alone
+		case push && r == b, !push && l == b:
+			transfer = append(transfer, p)
+		default:
+			// Both changed, or the destination changed on its own
+			blocked = append(blocked, p)
+		}
+	}
+	sort.Strings(transfer)
+	sort.Strings(blocked)
+	if len(blocked) > 0 && !force {
+		what := "changed on both sides"
+		if push {
+			what = "changed on the remote since the last sync (pull first)"
+		}
+		return fmt.Errorf("%d files %s: %s; pass --force to overwrite them", len(blocked), what, strings.Join(blocked, ", "))
+	}
+	if force {
+		transfer = append(transfer, blocked...)
+	}
+
+	for _, p := range transfer {
+		localPath := filepath.Join(secretsDir, filepath.FromSlash(p))
+		remotePath := remote + "/" + p
+		var err error
+		switch {
+		case push && local[p] == "":
+			err = rclone("deletefile", remotePath)
+		case push:
+			err = rclone("copyto", localPath, remotePath)
+		case remoteFiles[p] == "":
+			err = os.Remove(localPath)
+			pruneEmptyDirs(filepath.Dir(localPath))
+		default:
+			if err = makeSecretDir(filepath.Dir(localPath)); err == nil {
+				err = rclone("copyto", remotePath, localPath)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("syncing %s: %w", p, err)
+		}
+		printVerbose("Synced %s\n", p)
+		if push {
+			remoteFiles[p] = local[p]
+		} else {
+			local[p] = remoteFiles[p]
+		}
+	}
+
+	// Files that still differ keep their old base, so a change kept by pull
+	// is pushed later rather than mistaken for a conflict
+	for p := range paths {
+		if local[p] == remoteFiles[p] {
+			base[p] = local[p]
+		}
+		if base[p] == "" {
+			delete(base, p)
+		}
+	}
+	if err := saveSyncState(base); err != nil {
+		return err
+	}
+	direction := "Pulled"
+	if push {
+		direction = "Pushed"
+	}
+	printStatus("✓ %s %d files\n", direction, len(transfer))
+	return nil
+}
+
+func rclone(args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("rclone", args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("rclone %s: %s", args[0], msg)
+		}
+		return fmt.Errorf("rclone %s: %w", args[0], err)
+	}
+	return nil
+}
+
+// remoteHashes lists the SHA-256 of every file on the remote. A remote
+// directory that doesn't exist yet is empty.
+func remoteHashes(remote string) (map[string]string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("rclone", "hashsum", "sha256", "--download", remote)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		// rclone exits 3 for a missing directory
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 3 {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("listing %s: %s", remote, strings.TrimSpace(stderr.String()))
+	}
+	hashes := map[string]string{}
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || skipSyncPath(name) {
+			continue
+		}
+		hashes[name] = sum
+	}
+	return hashes, nil
+}
+
+// localHashes returns the SHA-256 of every file in the secrets directory.
+func localHashes() (map[string]string, error) {
+	hashes := map[string]string{}
+	err := filepath.WalkDir(secretsDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(secretsDir, p)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if p != secretsDir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if skipSyncPath(rel) {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		hashes[rel] = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading secrets directory: %w", err)
+	}
+	return hashes, nil
+}
+
+// skipSyncPath excludes the sync state itself, files in hidden directories
+// and leftovers from interrupted writes.
+func skipSyncPath(name string) bool {
+	for _, part := range strings.Split(path.Dir(name), "/") {
+		if strings.HasPrefix(part, ".") && part != "." {
+			return true
+		}
+	}
+	return name == syncStateFile || strings.HasSuffix(name, ".tmp")
+}
+
+func loadSyncState() (map[string]string, error) {
+	state := map[string]string{}
+	data, err := ioutil.ReadFile(filepath.Join(secretsDir, syncStateFile))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading sync state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parsing sync state: %w", err)
+	}
+	return state, nil
+}
+
+func saveSyncState(state map[string]string) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(secretsDir, syncStateFile), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("writing sync state: %w", err)
+	}
+	return nil
+}
+
+func git(args ...string) error {
+	cmd := exec.Command("git", append([]string{"-C", secretsDir}, args...)...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// gitCommit commits any changes in the secrets directory, so they take part
+// in the merge rather than blocking it.
+func gitCommit() error {
+	if err := git("add", "-A", "."); err != nil {
+		return fmt.Errorf("git add: %w", err)
+	}
+	// Nothing staged is not an error
+	if git("diff", "--cached", "--quiet", "--", ".") != nil {
+		if err := git("commit", "-q", "-m", "Update secrets", "--", "."); err != nil {
+			return fmt.Errorf("git commit: %w", err)
+		}
+	}
+	return nil
+}
+
+// gitPush commits everything in the secrets directory and pushes it. git
+// itself refuses to push over remote changes unless forced.
+func gitPush(force bool) error {
+	if err := gitCommit(); err != nil {
+		return err
+	}
+	args := []string{"push"}
+	if force {
+		args = append(args, "--force-with-lease")
+	}
+	if cfg.SyncRemote != "" {
+		args = append(args, cfg.SyncRemote)
+	}
+	if err := git(args...); err != nil {
+		return fmt.Errorf("git push failed; pull first or pass --force: %w", err)
+	}
+	printStatus("✓ Pushed\n")
+	return nil
+}
+
+// gitPull merges remote changes. On conflicts the merge is aborted and the
+// conflicting files reported, unless force resolves them in the remote's
+// favour.
+func gitPull(force bool) error {
+	if err := gitCommit(); err != nil {
+		return err
+	}
+	args := []string{"pull", "--no-rebase", "--no-edit"}
+	if force {
+		args = append(args, "-X", "theirs")
+	}
+	if cfg.SyncRemote != "" {
+		args = append(args, cfg.SyncRemote)
+	}
+	if err := git(args...); err != nil {
+		out, _ := exec.Command("git", "-C", secretsDir, "diff", "--name-only", "--diff-filter=U").Output()
+		conflicts := strings.Fields(string(out))
+		if len(conflicts) == 0 {
+			return fmt.Errorf("git pull: %w", err)
+		}
+		git("merge", "--abort")
+		return fmt.Errorf("%d files changed on both sides: %s; pass --force to take the remote's version", len(conflicts), strings.Join(conflicts, ", "))
+	}
+	printStatus("✓ Pulled\n")
+	return nil
+}
+
+func init() {
+	for _, c := range []*cobra.Command{syncPushCmd, syncPullCmd} {
+		c.Flags().Bool("force", false, "overwrite conflicting changes on the destination side")
+	}
+	syncCmd.AddCommand(syncPushCmd, syncPullCmd)
+}
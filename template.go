@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var templateCmd = &cobra.Command{
+	Use:   "template [template-file]",
+	Short: "Render a template with secrets injected",
+	Long: `Render a Go text/template, replacing {{ secret "name" }} with the
+decrypted value of that secret (without its trailing newline), and
+{{ secretOr "name" "fallback" }} likewise, or with the fallback when the
+secret does not exist.
+
+A missing secret used with secret fails the render, after listing every
+missing secret, unless --on-missing is empty (render "") or default
+(render --missing-value).
+
+With --manifest, render every {template, output} pair listed in a YAML file.
+Paths in the manifest are relative to the manifest itself. Nothing is
+written unless every template renders.`,
+	Args: usageArgs(cobra.MaximumNArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifest, _ := cmd.Flags().GetString("manifest")
+		output, _ := cmd.Flags().GetString("output")
+
+		if manifest != "" {
+			if len(args) > 0 || output != "" {
+				return fmt.Errorf("%w: --manifest cannot be combined with a template file or --output", ErrUsage)
+			}
+			r, err := rendererFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			return renderManifest(manifest, r)
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("%w: a template file or --manifest is required", ErrUsage)
+		}
+
+		r, err := rendererFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		out, err := r.render(args[0])
+		if err != nil {
+			return err
+		}
+		if output == "" {
+			os.Stdout.Write(out)
+			return nil
+		}
+		return writeRendered([]renderedFile{{path: output, data: out}})
+	},
+}
+
+// renderer renders templates and decrypts each referenced secret only once.
+type renderer struct {
+	values map[string]string
+	// missing holds the secrets templates asked for that don't exist
+	missing map[string]bool
+	// onMissing is what secret does with a missing secret: "error", or
+	// render "empty" or the "default" missingValue
+	onMissing    string
+	missingValue string
+	// unresolved lists the missing secrets failing the current render
+	unresolved []string
+}
+
+func newRenderer() *renderer {
+	return &renderer{values: map[string]string{}, missing: map[string]bool{}, onMissing: "error"}
+}
+
+// rendererFromFlags returns a renderer with the --on-missing policy.
+func rendererFromFlags(cmd *cobra.Command) (*renderer, error) {
+	r := newRenderer()
+	r.onMissing, _ = cmd.Flags().GetString("on-missing")
+	r.missingValue, _ = cmd.Flags().GetString("missing-value")
+	switch r.onMissing {
+	case "error", "empty", "default":
+		return r, nil
+	}
+	return nil, fmt.Errorf("%w: --on-missing must be error, empty or default", ErrUsage)
+}
+
+// lookup returns the value of secret name, or ok false if it doesn't exist.
+func (r *renderer) lookup(name string) (value string, ok bool, err error) {
+	secretName, secretPath, err := resolveSecret(name)
+	if err != nil {
+		return "", false, err
+	}
+	if v, ok := r.values[secretName]; ok {
+		return v, true, nil
+	}
+	if _, err := os.Stat(secretPath); os.IsNotExist(err) {
+		r.missing[secretName] = true
+		return "", false, nil
+	}
+	content, err := decryptSecret(secretPath)
+	if err != nil {
+		return "", false, fmt.Errorf("secret %q: %w", name, err)
+	}
+	v := strings.TrimSuffix(content, "\n")
+	r.values[secretName] = v
+	return v, true, nil
+}
+
+func (r *renderer) secret(name string) (string, error) {
+	v, ok, err := r.lookup(name)
+	if err != nil || ok {
+		return v, err
+	}
+	switch r.onMissing {
+	case "empty":
+		return "", nil
+	case "default":
+		return r.missingValue, nil
+	}
+	// Carry on so that one run reports every missing secret
+	r.unresolved = append(r.unresolved, name)
+	return "", nil
+}
+
+func (r *renderer) secretOr(name, fallback string) (string, error) {
+	v, ok, err := r.lookup(name)
+	if err != nil || ok {
+		return v, err
+	}
+	return fallback, nil
+}
+
+func (r *renderer) render(path string) ([]byte, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).
+		Funcs(template.FuncMap{"secret": r.secret, "secretOr": r.secretOr}).
+		Parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+	r.unresolved = nil
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return nil, fmt.Errorf("rendering %s: %w", path, err)
+	}
+	if len(r.unresolved) > 0 {
+		return nil, fmt.Errorf("rendering %s: %w: %s", path, ErrSecretNotFound, strings.Join(r.unresolved, ", "))
+	}
+	return buf.Bytes(), nil
+}
+
+// manifestEntry is one template/output pair in a --manifest file.
+type manifestEntry struct {
+	Template string `yaml:"template"`
+	Output   string `yaml:"output"`
+}
+
+type renderedFile struct {
+	path string
+	data []byte
+}
+
+// renderManifest renders and writes every entry of the manifest at path.
+// Afterwards r holds the secrets the templates used.
+func renderManifest(path string, r *renderer) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading manifest: %w", err)
+	}
+	var entries []manifestEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("parsing manifest: %w", err)
+	}
+
+	base := filepath.Dir(path)
+	resolve := func(p string) string {
+		if filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(base, p)
+	}
+
+	// Render everything before writing anything so a missing secret never
+	// leaves a half-rendered deploy behind
+	var files []renderedFile
+	var errs []error
+	for i, e := range entries {
+		if e.Template == "" || e.Output == "" {
+			return fmt.Errorf("manifest entry %d needs both template and output", i+1)
+		}
+		out, err := r.render(resolve(e.Template))
+		if err != nil {
+			// Go on, so every template's missing secrets are reported
+			errs = append(errs, err)
+			continue
+		}
+		files = append(files, renderedFile{path: resolve(e.Output), data: out})
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return writeRendered(files)
+}
+
+// writeRendered stages every file next to its destination and only renames
+// them into place once all were written.
+func writeRendered(files []renderedFile) error {
+	var staged []string
+	cleanup := func() {
+		for _, tmp := range staged {
+			os.Remove(tmp)
+		}
+	}
+	for _, f := range files {
+		tmp := f.path + ".tmp"
+		if err := ioutil.WriteFile(tmp, f.data, 0600); err != nil {
+			cleanup()
+			return fmt.Errorf("writing %s: %w", f.path, err)
+		}
+		// WriteFile keeps the mode of an existing file
+		if err := os.Chmod(tmp, 0600); err != nil {
+			cleanup()
+			return fmt.Errorf("writing %s: %w", f.path, err)
+		}
+		staged = append(staged, tmp)
+	}
+	for i, f := range files {
+		if err := os.Rename(staged[i], f.path); err != nil {
+			cleanup()
+			return fmt.Errorf("writing %s: %w", f.path, err)
+		}
+		printStatus("✓ Wrote %s\n", f.path)
+	}
+	return nil
+}
+
+func init() {
+	templateCmd.Flags().String("on-missing", "error", "what secret renders for a missing secret: error, empty or default")
+	templateCmd.Flags().String("missing-value", "", "with --on-missing default, the value rendered for missing secrets")
+	templateCmd.Flags().String("manifest", "", "YAML file listing {template, output} pairs to render together")
+	templateCmd.Flags().StringP("output", "o", "", "write the rendered template to this file with 0600 permissions")
+}
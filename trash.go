@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Removed secrets are moved to .trash under the store, as name.TIMESTAMP,
+// unless the trash setting is false or remove --hard is used. As a hidden
+// directory it is invisible to list, sync and the bulk commands.
+const trashTimeFormat = "20060102T150405Z"
+
+func trashDir() string {
+	return filepath.Join(secretsDir, ".trash")
+}
+
+func useTrash() bool {
+	return cfg.Trash == nil || *cfg.Trash
+}
+
+// trashMetaSuffix names the copy of a trashed secret's meta.json entry kept
+// beside it, so that restore brings back its description and protection.
+const trashMetaSuffix = ".meta.json"
+
+// trashSecret moves secret name, its recorded recipients and a copy of its
+// metadata into the trash.
+func trashSecret(name string) error {
+	src := filepath.Join(secretsDir, filepath.FromSlash(name))
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	base := filepath.Join(trashDir(), filepath.FromSlash(name))
+	// Removing the same name twice within a second must not overwrite
+	t := time.Now().UTC()
+	dst := base + "." + t.Format(trashTimeFormat)
+	for _, err := os.Stat(dst); err == nil; _, err = os.Stat(dst) {
+		t = t.Add(time.Second)
+		dst = base + "." + t.Format(trashTimeFormat)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return fmt.Errorf("creating trash: %w", err)
+	}
+	meta, err := loadMeta()
+	if err != nil {
+		return err
+	}
+	if m, ok := meta[name]; ok {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst+trashMetaSuffix, data, 0600); err != nil {
+			return fmt.Errorf("saving metadata to the trash: %w", err)
+		}
+	}
+	if err := os.Rename(src, dst); err != nil {
+		os.Remove(dst + trashMetaSuffix)
+		return err
+	}
+	// Neither the sidecar's name nor the metadata copy's ends in a
+	// timestamp, so listTrash skips both
+	if err := os.Rename(sidecarPath(src), sidecarPath(dst)); err != nil && !os.IsNotExist(err) {
+		printWarning("Warning: moving recorded recipients to the trash: %v\n", err)
+	}
+	return nil
+}
+
+// trashEntry is one removed secret in the trash.
+type trashEntry struct {
+	Name    string
+	Removed time.Time
+	path    string
+}
+
+// listTrash returns the trash entries, most recently removed first.
+func listTrash() ([]trashEntry, error) {
+	var entries []trashEntry
+	err := filepath.WalkDir(trashDir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == trashDir() {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(trashDir(), path)
+		rel = filepath.ToSlash(rel)
+		i := strings.LastIndex(rel, ".")
+		if i < 0 {
+			return nil
+		}
+		removed, err := time.Parse(trashTimeFormat, rel[i+1:])
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, trashEntry{Name: rel[:i], Removed: removed, path: path})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading trash: %w", err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Removed.After(entries[j].Removed)
+	})
+	return entries, nil
+}
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "List, restore or empty removed secrets",
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List removed secrets, most recent first",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := listTrash()
+		if err != nil {
+			return err
+		}
+		width := 0
+		for _, e := range entries {
+			width = max(width, len(displayName(e.Name)))
+		}
+		for _, e := range entries {
+			fmt.Printf("%-*s  removed %s\n", width, displayName(e.Name), e.Removed.Local().Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore [secret-name]",
+	Short: "Restore the most recently removed version of a secret",
+	Args:  usageArgs(cobra.ExactArgs(1)),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+		secretName, secretPath, err := resolveSecret(args[0])
+		if err != nil {
+			return err
+		}
+		entries, err := listTrash()
+		if err != nil {
+			return err
+		}
+		var entry *trashEntry
+		for i := range entries {
+			if entries[i].Name == secretName {
+				entry = &entries[i]
+				break
+			}
+		}
+		if entry == nil {
+			return fmt.Errorf("%w: %s is not in the trash", ErrSecretNotFound, displayName(secretName))
+		}
+		if _, err := os.Stat(secretPath); err == nil && !force {
+			return fmt.Errorf("%s exists; pass --force to replace it", displayName(secretName))
+		}
+		if dryRun {
+			printDryRun("restore %s from %s", secretPath, entry.path)
+			return nil
+		}
+
+		if err := makeSecretDir(filepath.Dir(secretPath)); err != nil {
+			return fmt.Errorf("creating directory: %w", err)
+		}
+		if err := os.Rename(entry.path, secretPath); err != nil {
+			return fmt.Errorf("restoring secret: %w", err)
+		}
+		removeSidecar(secretPath)
+		if err := os.Rename(sidecarPath(entry.path), sidecarPath(secretPath)); err != nil && !os.IsNotExist(err) {
+			printWarning("Warning: restoring recorded recipients: %v\n", err)
+		}
+		if err := restoreMeta(secretName, entry.path); err != nil {
+			printWarning("Warning: restoring metadata: %v\n", err)
+		}
+		pruneEmptyDirs(filepath.Dir(entry.path))
+		printStatus("✓ Secret '%s' restored (removed %s)\n", displayName(secretName), entry.Removed.Local().Format("2006-01-02 15:04:05"))
+		return runHook("restore", secretName)
+	},
+}
+
+// restoreMeta gives secret name the metadata saved with the trash entry at
+// path, or none if nothing was saved, and removes the saved copy.
+func restoreMeta(name, path string) error {
+	var m secretMeta
+	data, err := os.ReadFile(path + trashMetaSuffix)
+	if err == nil {
+		if err := json.Unmarshal(data, &m); err != nil {
+			return fmt.Errorf("parsing %s: %w", path+trashMetaSuffix, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	meta, err := loadMeta()
+	if err != nil {
+		return err
+	}
+	if m == meta[name] {
+		os.Remove(path + trashMetaSuffix)
+		return nil
+	}
+	meta[name] = m
+	if err := saveMeta(meta); err != nil {
+		return err
+	}
+	os.Remove(path + trashMetaSuffix)
+	return nil
+}
+
+var trashEmptyCmd = &cobra.Command{
+	Use:   "empty",
+	Short: "Delete everything in the trash for good",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+		entries, err := listTrash()
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			printStatus("✓ The trash is empty\n")
+			return nil
+		}
+		if dryRun {
+			for _, e := range entries {
+				printDryRun("delete %s", e.path)
+			}
+			return nil
+		}
+		if !force && !confirm(fmt.Sprintf("Permanently delete %d removed secrets?", len(entries))) {
+			return fmt.Errorf("aborted")
+		}
+		if err := os.RemoveAll(trashDir()); err != nil {
+			return fmt.Errorf("emptying trash: %w", err)
+		}
+		printStatus("✓ Deleted %d secrets from the trash\n", len(entries))
+		return nil
+	},
+}
+
+func init() {
+	trashRestoreCmd.Flags().BoolP("force", "f", false, "replace an existing secret of the same name")
+	trashEmptyCmd.Flags().BoolP("force", "f", false, "do not ask for confirmation")
+	trashCmd.AddCommand(trashListCmd, trashRestoreCmd, trashEmptyCmd)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrashRestoreKeepsMeta(t *testing.T) {
+	useTestStore(t)
+	testSecret(t, "prod/db", []byte("hunter2\n"))
+	want := secretMeta{Description: "primary database", Protected: true}
+	if err := saveMeta(map[string]secretMeta{"prod/db.age": want}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeCmd.RunE(removeCmd, []string{"prod/db"}); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	meta, err := loadMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := meta["prod/db.age"]; ok {
+		t.Error("a trashed secret keeps its meta.json entry")
+	}
+
+	if err := trashRestoreCmd.RunE(trashRestoreCmd, []string{"prod/db"}); err != nil {
+		t.Fatalf("trash restore: %v", err)
+	}
+	if meta, err = loadMeta(); err != nil {
+		t.Fatal(err)
+	}
+	if got := meta["prod/db.age"]; got != want {
+		t.Errorf("restored metadata = %+v, want %+v", got, want)
+	}
+	// Tests don't run on a terminal, where confirmReveal would ask instead
+	if err := confirmReveal("prod/db", false); exitCode(err) != exitUsage {
+		t.Errorf("confirmReveal of the restored secret = %v, want it refused", err)
+	}
+	if _, err := os.Stat(trashDir()); err == nil {
+		filepath.WalkDir(trashDir(), func(path string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				t.Errorf("%s left in the trash", path)
+			}
+			return nil
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [secret-name...]",
+	Short: "Check that secrets decrypt with the identity",
+	Long: `Decrypt the given secrets, or all of them, and discard the plaintext,
+reporting those that fail. Secrets are decrypted --jobs at a time; failures
+are listed in name order however the work finishes.`,
+	ValidArgsFunction: completeSecretNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobs, _ := cmd.Flags().GetInt("jobs")
+		if jobs < 1 {
+			return fmt.Errorf("%w: --jobs must be at least 1", ErrUsage)
+		}
+		names, excluded, err := rekeyTargets(args)
+		if err != nil {
+			return err
+		}
+		sort.Strings(names)
+		paths := make([]string, len(names))
+		for i, name := range names {
+			paths[i] = filepath.Join(secretsDir, filepath.FromSlash(name))
+		}
+		if err := unlockForWorkers(); err != nil {
+			return err
+		}
+
+		// Passphrase secrets prompt, and prompts can't take turns
+		var parallel, serial []int
+		for i, path := range paths {
+			if isPassphraseSecret(path) {
+				serial = append(serial, i)
+			} else {
+				parallel = append(parallel, i)
+			}
+		}
+		// Each worker writes only the slots of the secrets it took
+		errs := make([]error, len(names))
+		work := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < min(jobs, len(parallel)); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range work {
+					_, errs[i] = decryptSecret(paths[i])
+				}
+			}()
+		}
+		for _, i := range parallel {
+			work <- i
+		}
+		close(work)
+		wg.Wait()
+		for _, i := range serial {
+			_, errs[i] = decryptSecret(paths[i])
+		}
+
+		res := bulkResult{Excluded: excluded}
+		for i, name := range names {
+			if errs[i] != nil {
+				res.fail(name, errs[i])
+			} else {
+				res.Processed = append(res.Processed, name)
+			}
+		}
+		for _, name := range res.Failed {
+			printWarning("✗ %s: %v\n", displayName(name), res.Errors[name])
+		}
+		if len(res.Failed) > 0 {
+			return fmt.Errorf("%d of %d secrets could not be decrypted: %s", len(res.Failed), len(names), strings.Join(displayNames(res.Failed), ", "))
+		}
+		printStatus("✓ All %d secrets decrypt%s\n", len(res.Processed), excludedNote(res.Excluded))
+		return nil
+	},
+}
+
+// unlockForWorkers does the parts of decrypting that may prompt or that set
+// up shared state, once and up front, so that decryptSecret can then run in
+// several goroutines.
+func unlockForWorkers() error {
+	if _, ok, err := memoryIdentities(); ok {
+		return err
+	}
+	paths := decryptWith
+	if len(paths) == 0 {
+		paths = []string{keyPath}
+	}
+	for _, p := range paths {
+		if isEncryptedIdentity(expandHome(p)) {
+			if _, err := unlockIdentity(expandHome(p)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func init() {
+	verifyCmd.Flags().IntP("jobs", "j", runtime.GOMAXPROCS(0), "number of secrets to decrypt at once")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVerifyReportsCorruptSecret(t *testing.T) {
+	corruptions := map[string]func(path string) error{
+		"truncated": func(path string) error {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(path, data[:len(data)/2], 0600)
+		},
+		"garbage": func(path string) error {
+			return os.WriteFile(path, []byte("age-encryption.org/v1\n-> X25519 nonsense\n--- \x00\x01\x02"), 0600)
+		},
+		"plaintext": func(path string) error {
+			return os.WriteFile(path, []byte("not encrypted at all\n"), 0600)
+		},
+	}
+	tests := []struct {
+		good    int
+		corrupt string
+	}{
+		{1, "truncated"},
+		{20, "truncated"},
+		{20, "garbage"},
+		{50, "plaintext"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d good, %s", tt.good, tt.corrupt), func(t *testing.T) {
+			useTestStore(t)
+			for i := 0; i < tt.good; i++ {
+				testSecret(t, fmt.Sprintf("ns/good%02d", i), []byte(fmt.Sprintf("value %d\n", i)))
+			}
+			if err := corruptions[tt.corrupt](testSecret(t, "ns/bad", []byte("doomed\n"))); err != nil {
+				t.Fatal(err)
+			}
+
+			err := verifyCmd.RunE(verifyCmd, nil)
+			if exitCode(err) == exitOK {
+				t.Fatal("verify succeeded with a corrupt secret")
+			}
+			want := fmt.Sprintf("1 of %d secrets could not be decrypted: ns/bad", tt.good+1)
+			if err.Error() != want {
+				t.Errorf("error = %q, want %q", err, want)
+			}
+		})
+	}
+}
+
+func TestVerifyAllGood(t *testing.T) {
+	useTestStore(t)
+	for i := 0; i < 10; i++ {
+		testSecret(t, fmt.Sprintf("good%d", i), []byte("value"))
+	}
+	if err := verifyCmd.RunE(verifyCmd, nil); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+	useTestStore(b)
+	for i := 0; i < 300; i++ {
+		testSecret(b, fmt.Sprintf("ns%d/secret%03d", i%10, i), []byte(strings.Repeat("x", 64)))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := verifyCmd.RunE(verifyCmd, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
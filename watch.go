@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+)
+
+// watchDebounce is how long watch waits for changes to settle before
+// rendering, so that a burst of writes renders once.
+const watchDebounce = 300 * time.Millisecond
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Re-render a template manifest whenever a secret it uses changes",
+	Args:  usageArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifest, _ := cmd.Flags().GetString("manifest")
+		if manifest == "" {
+			return fmt.Errorf("%w: --manifest is required", ErrUsage)
+		}
+
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return fmt.Errorf("starting watcher: %w", err)
+		}
+		defer watcher.Close()
+		if err := watchTree(watcher, secretsDir); err != nil {
+			return err
+		}
+
+		// used holds the secrets the last render read, or nil after a
+		// failed render so that any change retries it
+		var used map[string]string
+		render := func(reason string) {
+			r := newRenderer()
+			if err := renderManifest(manifest, r); err != nil {
+				printWarning("✗ %s: %v\n", time.Now().Format("15:04:05"), err)
+				used = nil
+				return
+			}
+			used = r.values
+			// Creating a secret that was missing changes the output too
+			for name := range r.missing {
+				used[name] = ""
+			}
+			printStatus("✓ %s: rendered %s (%s)\n", time.Now().Format("15:04:05"), manifest, reason)
+		}
+		render("initial render")
+
+		var (
+			timer   <-chan time.Time
+			changed = map[string]bool{}
+		)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return nil
+				}
+				if event.Has(fsnotify.Create) {
+					// New namespaces need watching too
+					watchTree(watcher, event.Name)
+				}
+				name, ok := watchedSecret(event.Name)
+				if !ok {
+					continue
+				}
+				if _, relevant := used[name]; used != nil && !relevant {
+					continue
+				}
+				changed[name] = true
+				timer = time.After(watchDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return nil
+				}
+				printWarning("Warning: watching %s: %v\n", secretsDir, err)
+			case <-timer:
+				var names []string
+				for name := range changed {
+					names = append(names, name)
+				}
+				changed = map[string]bool{}
+				timer = nil
+				render("changed: " + strings.Join(names, ", "))
+			}
+		}
+	},
+}
+
+// watchTree adds dir and every directory below it to the watcher, skipping
+// hidden ones like getSecretNames does.
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != secretsDir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("watching %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// watchedSecret returns the secret name for a path reported by the watcher,
+// if it is a secret rather than a temporary or unrelated file.
+func watchedSecret(path string) (string, bool) {
+	if !strings.HasSuffix(path, ".age") {
+		return "", false
+	}
+	rel, err := filepath.Rel(secretsDir, path)
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func init() {
+	watchCmd.Flags().String("manifest", "", "YAML file listing {template, output} pairs to render")
+	watchCmd.MarkFlagFilename("manifest", "yaml", "yml")
+}
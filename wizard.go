@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// placeholderRecipient is the key generate writes into a new recipients
+// file. Nobody using this store holds its identity.
+const placeholderRecipient = "age1k0sc4ugaxzpav2rs8cmugwthaa3tpuzygvax8u84m6sm9ldh737qspv058"
+
+// onlyPlaceholder reports whether the recipients file is still the one
+// generate wrote.
+func onlyPlaceholder() bool {
+	if recipientsCommand() != "" || len(recipientsFiles) > 1 {
+		return false
+	}
+	recipients, err := loadRecipients(recipientsFile)
+	return err == nil && len(recipients) == 1 && recipients[0].Key == placeholderRecipient
+}
+
+// firstRunWizard offers to set up an identity when add or edit would
+// otherwise encrypt to the placeholder. --yes accepts without asking and
+// --no-warn-placeholder skips the check entirely.
+func firstRunWizard(cmd *cobra.Command) error {
+	if skip, _ := cmd.Flags().GetBool("no-warn-placeholder"); skip || !onlyPlaceholder() {
+		return nil
+	}
+	yes, _ := cmd.Flags().GetBool("yes")
+	if !yes && !isTerminal(os.Stdin) {
+		// Don't swallow piped input with a prompt
+		printWarning("Warning: %s only contains the placeholder recipient; nobody will be able to decrypt this secret\n", recipientsFile)
+		return nil
+	}
+
+	path := identityPath()
+	_, statErr := os.Stat(path)
+	haveIdentity := statErr == nil
+
+	if !yes {
+		fmt.Fprintf(os.Stderr, "%s only contains the placeholder recipient, so nobody could decrypt this secret.\n", recipientsFile)
+		question := fmt.Sprintf("Generate a new age identity at %s and use it as the recipient?", path)
+		if haveIdentity {
+			question = fmt.Sprintf("Use the identity at %s as the recipient?", path)
+		}
+		if !confirm(question) {
+			return fmt.Errorf("aborted: add a real recipient with 'secrets recipients add'")
+		}
+	}
+
+	var recipient string
+	if haveIdentity {
+		r, err := identityRecipient(path)
+		if err != nil {
+			return err
+		}
+		recipient = r
+	} else {
+		identity, err := age.GenerateX25519Identity()
+		if err != nil {
+			return fmt.Errorf("generating identity: %w", err)
+		}
+		if err := writeIdentity(path, identity); err != nil {
+			return err
+		}
+		recipient = identity.Recipient().String()
+		printStatus("✓ Wrote new identity to %s\n", path)
+	}
+
+	if err := replacePlaceholder(recipient); err != nil {
+		return err
+	}
+	printStatus("✓ Set %s as the only recipient\n", recipient)
+	return nil
+}
+
+// replacePlaceholder rewrites the recipients file generate created with
+// recipient in place of the placeholder.
+func replacePlaceholder(recipient string) error {
+	content := "# Add age public keys, one per line\n\n" + recipient + "\n"
+	if err := ioutil.WriteFile(recipientsFile, []byte(content), 0644); err != nil {
+		return fmt.Errorf("writing recipients file: %w", err)
+	}
+	return nil
+}
+
+// writeIdentity saves identity in the format age-keygen uses, refusing to
+// replace an existing file.
+func writeIdentity(path string, identity *age.X25519Identity) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating key directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("writing identity: %w", err)
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "# created: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(f, "# public key: %s\n", identity.Recipient())
+	if _, err := fmt.Fprintf(f, "%s\n", identity); err != nil {
+		return fmt.Errorf("writing identity: %w", err)
+	}
+	return nil
+}
+
+// identityRecipient derives the public key of the first X25519 identity in
+// the file at path.
+func identityRecipient(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading identity: %w", err)
+	}
+	identities, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("parsing identity %s: %w", path, err)
+	}
+	for _, id := range identities {
+		if x, ok := id.(*age.X25519Identity); ok {
+			return x.Recipient().String(), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no X25519 identity to derive a recipient from", path)
+}
+
+// isTerminal reports whether f is an interactive terminal. Checking for a
+// character device is not enough, as /dev/null is one too.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}